@@ -0,0 +1,86 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"stock-search/credentials"
+	"stock-search/models"
+	"stock-search/search"
+	"strings"
+)
+
+// Reindexer is implemented by engines that can rebuild their index in the background
+type Reindexer interface {
+	StartRebuild(load func() ([]models.Stock, error), swapped func([]models.Stock)) error
+	RebuildStatus() search.RebuildStatus
+}
+
+// AdminHandler serves the operational endpoints under /admin. Every request
+// must carry the ADMIN_TOKEN credential as a bearer token; without a configured
+// token the endpoints are disabled
+type AdminHandler struct {
+	Engine       Reindexer
+	Load         func() ([]models.Stock, error) // re-reads the data files for a rebuild
+	Swapped      func([]models.Stock)           // updates what is derived from the stocks once the rebuilt index serves them
+	CredProvider credentials.Provider
+}
+
+func NewAdminHandler(engine Reindexer, load func() ([]models.Stock, error), swapped func([]models.Stock)) *AdminHandler {
+	return &AdminHandler{
+		Engine:       engine,
+		Load:         load,
+		Swapped:      swapped,
+		CredProvider: credentials.NewEnvProvider(),
+	}
+}
+
+// Reindex starts a background index rebuild on POST and reports the status of
+// the latest rebuild on GET
+func (h *AdminHandler) Reindex(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		err := h.Engine.StartRebuild(h.Load, h.Swapped)
+		if errors.Is(err, search.ErrRebuildInProgress) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(h.Engine.RebuildStatus())
+		return
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.Engine.RebuildStatus())
+}
+
+// authorize checks the bearer token and writes the error response if it is missing or wrong
+func (h *AdminHandler) authorize(w http.ResponseWriter, r *http.Request) bool {
+	token, err := h.CredProvider.GetCredential("ADMIN_TOKEN")
+	if err != nil {
+		http.Error(w, "Admin endpoints are disabled: ADMIN_TOKEN is not configured", http.StatusForbidden)
+		return false
+	}
+
+	given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
@@ -2,11 +2,13 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"stock-search/credentials"
+	"stock-search/loader"
 	"time"
 )
 
@@ -64,7 +66,7 @@ func NewAngelOneClient(credProvider credentials.Provider) *AngelOneClient {
 }
 
 // Authenticate performs login and retrieves JWT token
-func (c *AngelOneClient) Authenticate() error {
+func (c *AngelOneClient) Authenticate(ctx context.Context) error {
 	// Check if token is still valid (valid for 10 minutes)
 	if c.jwtToken != "" && time.Since(c.tokenTime) < 9*time.Minute {
 		return nil
@@ -95,7 +97,7 @@ func (c *AngelOneClient) Authenticate() error {
 		return fmt.Errorf("failed to marshal login request: %v", err)
 	}
 
-	req, err := http.NewRequest("POST", c.config.BaseURL+"/rest/auth/angelbroking/user/v1/loginByPassword", bytes.NewBuffer(reqBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", c.config.BaseURL+"/rest/auth/angelbroking/user/v1/loginByPassword", bytes.NewBuffer(reqBody))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %v", err)
 	}
@@ -137,8 +139,8 @@ func (c *AngelOneClient) Authenticate() error {
 }
 
 // GetHistoricalData fetches historical candle data
-func (c *AngelOneClient) GetHistoricalData(exchange, symbolToken, interval, fromDate, toDate string) ([]PricePoint, error) {
-	if err := c.Authenticate(); err != nil {
+func (c *AngelOneClient) GetHistoricalData(ctx context.Context, exchange, symbolToken, interval, fromDate, toDate string) ([]PricePoint, error) {
+	if err := c.Authenticate(ctx); err != nil {
 		return nil, fmt.Errorf("authentication failed: %v", err)
 	}
 
@@ -157,7 +159,7 @@ func (c *AngelOneClient) GetHistoricalData(exchange, symbolToken, interval, from
 		return nil, fmt.Errorf("failed to marshal request: %v", err)
 	}
 
-	req, err := http.NewRequest("POST", c.config.BaseURL+"/rest/secure/angelbroking/historical/v1/getCandleData", bytes.NewBuffer(reqBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", c.config.BaseURL+"/rest/secure/angelbroking/historical/v1/getCandleData", bytes.NewBuffer(reqBody))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %v", err)
 	}
@@ -193,7 +195,7 @@ func (c *AngelOneClient) GetHistoricalData(exchange, symbolToken, interval, from
 		return nil, fmt.Errorf("API error: %s", candleResp.Message)
 	}
 
-	// Convert Angel One data to our PricePoint format
+	// Convert Angel One candles to our PricePoint format
 	var pricePoints []PricePoint
 	for _, candle := range candleResp.Data {
 		if len(candle) < 5 {
@@ -206,16 +208,24 @@ func (c *AngelOneClient) GetHistoricalData(exchange, symbolToken, interval, from
 			continue
 		}
 
-		// Use close price for our chart
-		close, ok := candle[4].(float64)
-		if !ok {
+		var ohlc [4]float64 // open, high, low, close
+		valid := true
+		for i := range ohlc {
+			ohlc[i], ok = candle[i+1].(float64)
+			valid = valid && ok
+		}
+		if !valid {
 			continue
 		}
 
-		pricePoints = append(pricePoints, PricePoint{
-			Date:  timestamp,
-			Price: close,
-		})
+		var volume int64
+		if len(candle) > 5 {
+			if v, ok := candle[5].(float64); ok {
+				volume = int64(v)
+			}
+		}
+
+		pricePoints = append(pricePoints, newCandle(timestamp, ohlc[0], ohlc[1], ohlc[2], ohlc[3], volume))
 	}
 
 	return pricePoints, nil
@@ -246,33 +256,23 @@ func mapPeriodToAngelOneParams(period string) (interval string, duration time.Du
 	}
 }
 
-// FetchAngelOneData fetches stock data from Angel One API
-func FetchAngelOneData(symbol, exchange, period string, credProvider credentials.Provider) (*YahooData, error) {
-	client := NewAngelOneClient(credProvider)
-
-	// Map symbol to Angel One token
-	// For now, this is a placeholder - in production, you'd query Angel One's master contract API
-	// or maintain a mapping database
-	symbolToken := getAngelOneToken(symbol, exchange)
-	if symbolToken == "" {
-		return nil, fmt.Errorf("symbol token not found for %s on %s", symbol, exchange)
-	}
-
-	// Map exchange to Angel One exchange code
-	angelExchange := "NSE"
-	if exchange == "BSE" {
-		angelExchange = "BSE"
-	}
+// angelOneIntervals names Angel One candle intervals as the candle store does
+var angelOneIntervals = map[string]string{
+	"FIVE_MINUTE":    "5m",
+	"FIFTEEN_MINUTE": "15m",
+	"ONE_HOUR":       "1h",
+	"ONE_DAY":        IntervalDaily,
+	"ONE_WEEK":       "1wk",
+}
 
+// FetchAngelOneData fetches stock data from Angel One API, finding the
+// listing's token in the scrip master
+func FetchAngelOneData(ctx context.Context, symbol, exchange, period string, scrips *loader.ScripMaster, credProvider credentials.Provider) (*YahooData, error) {
 	interval, duration := mapPeriodToAngelOneParams(period)
 	toDate := time.Now()
 	fromDate := toDate.Add(-duration)
 
-	// Format dates as required by Angel One API (YYYY-MM-DD HH:MM)
-	fromDateStr := fromDate.Format("2006-01-02 15:04")
-	toDateStr := toDate.Format("2006-01-02 15:04")
-
-	history, err := client.GetHistoricalData(angelExchange, symbolToken, interval, fromDateStr, toDateStr)
+	history, err := fetchAngelOneCandles(ctx, symbol, exchange, interval, fromDate, toDate, scrips, credProvider)
 	if err != nil {
 		return nil, err
 	}
@@ -289,40 +289,33 @@ func FetchAngelOneData(symbol, exchange, period string, credProvider credentials
 		CurrentPrice:     currentPrice,
 		PreviousDayClose: previousDayClose,
 		History:          history,
+		Interval:         angelOneIntervals[interval],
 	}, nil
 }
 
-// getAngelOneToken returns the Angel One symbol token for a given symbol
-// This is a placeholder - in production, implement proper token lookup
-func getAngelOneToken(symbol, exchange string) string {
-	// Common stock tokens (these are examples - use actual tokens from Angel One)
-	tokens := map[string]map[string]string{
-		"NSE": {
-			"RELIANCE":   "2885",
-			"TCS":        "11536",
-			"HDFCBANK":   "1333",
-			"INFY":       "1594",
-			"ICICIBANK":  "4963",
-			"SBIN":       "3045",
-			"BHARTIARTL": "10604",
-			"ITC":        "1660",
-			"KOTAKBANK":  "1922",
-			"LT":         "11483",
-		},
-		"BSE": {
-			"RELIANCE":  "500325",
-			"TCS":       "532540",
-			"HDFCBANK":  "500180",
-			"INFY":      "500209",
-			"ICICIBANK": "532174",
-		},
+// FetchAngelOneDaily fetches the daily candles of a date range from Angel One
+func FetchAngelOneDaily(ctx context.Context, symbol, exchange string, from, to time.Time, scrips *loader.ScripMaster, credProvider credentials.Provider) ([]PricePoint, error) {
+	return fetchAngelOneCandles(ctx, symbol, exchange, "ONE_DAY", from, to, scrips, credProvider)
+}
+
+// fetchAngelOneCandles fetches the candles of a listing between two times
+func fetchAngelOneCandles(ctx context.Context, symbol, exchange, interval string, from, to time.Time, scrips *loader.ScripMaster, credProvider credentials.Provider) ([]PricePoint, error) {
+	client := NewAngelOneClient(credProvider)
+
+	symbolToken := scrips.Lookup(symbol, exchange)
+	if symbolToken == "" {
+		return nil, fmt.Errorf("symbol token not found for %s on %s", symbol, exchange)
 	}
 
-	if exchangeTokens, ok := tokens[exchange]; ok {
-		if token, ok := exchangeTokens[symbol]; ok {
-			return token
-		}
+	// Map exchange to Angel One exchange code
+	angelExchange := "NSE"
+	if exchange == "BSE" {
+		angelExchange = "BSE"
 	}
 
-	return ""
+	// Format dates as required by Angel One API (YYYY-MM-DD HH:MM)
+	fromDateStr := from.Format("2006-01-02 15:04")
+	toDateStr := to.Format("2006-01-02 15:04")
+
+	return client.GetHistoricalData(ctx, angelExchange, symbolToken, interval, fromDateStr, toDateStr)
 }
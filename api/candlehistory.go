@@ -0,0 +1,192 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"stock-search/models"
+	"time"
+)
+
+// storeProvider names the candle store as the source of a price history
+const storeProvider = "store"
+
+// dailyPeriods are the chart periods drawn from daily candles, which the candle
+// store serves
+var dailyPeriods = map[string]bool{"6M": true, "YTD": true, "1Y": true, "5Y": true}
+
+// intradayIntervals are the stored intervals that can chart the other periods,
+// finest first
+var intradayIntervals = map[string][]string{
+	"1D": {"5m"},
+	"1W": {"5m", "15m"},
+	"1M": {"30m", "1h"},
+}
+
+// SetCandleStore keeps the candles fetched from providers in store, serves
+// long-range charts from it, and falls back to it when no provider answers
+func (m *MarketData) SetCandleStore(store *CandleStore) {
+	m.store = store
+}
+
+// chartStart returns the start of the chart of a period ending at end
+func chartStart(period string, end time.Time) time.Time {
+	switch period {
+	case "1W":
+		return end.AddDate(0, 0, -7)
+	case "1M":
+		return end.AddDate(0, -1, 0)
+	case "6M":
+		return end.AddDate(0, -6, 0)
+	case "YTD":
+		return time.Date(end.Year(), time.January, 1, 0, 0, 0, 0, end.Location())
+	case "1Y":
+		return end.AddDate(-1, 0, 0)
+	case "5Y":
+		return end.AddDate(-5, 0, 0)
+	default: // the trading day of end
+		return time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, end.Location())
+	}
+}
+
+// Backfill stores the daily candles of a listing since from, fetching only what
+// the store is missing: the days since its last candle, or everything since
+// from if its history starts later. It returns the number of candles fetched
+func (m *MarketData) Backfill(ctx context.Context, stock *models.Stock, from time.Time) (int, error) {
+	if m.store == nil {
+		return 0, errors.New("no candle store")
+	}
+
+	start := from
+	covered, ok, err := m.store.Coverage(stock.Symbol, stock.Exchange, IntervalDaily)
+	if err != nil {
+		return 0, err
+	}
+	if ok && covered.Format("2006-01-02") <= from.Format("2006-01-02") {
+		last, ok, err := m.store.Last(stock.Symbol, stock.Exchange, IntervalDaily)
+		if err != nil {
+			return 0, err
+		}
+		// The last stored day is fetched again, as it may have been stored mid-session
+		if ok {
+			start, _ = candleTime(last.Date)
+		}
+	}
+
+	candles, err := m.fetchDaily(ctx, stock, start, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return len(candles), m.store.Put(stock.Symbol, stock.Exchange, IntervalDaily, start, candles)
+}
+
+// fetchDaily fetches daily candles from the first provider of the listing's
+// chain that has them
+func (m *MarketData) fetchDaily(ctx context.Context, stock *models.Stock, from, to time.Time) ([]PricePoint, error) {
+	var errs []error
+	for _, name := range m.chain(stock.Exchange, "") {
+		provider, _ := lookupProvider(name)
+		daily, ok := provider.(DailyCandleProvider)
+		if !ok {
+			continue
+		}
+		fetchCtx, cancel := context.WithTimeout(ctx, m.providerTimeout(name))
+		candles, err := daily.FetchDaily(fetchCtx, stock, from, to)
+		cancel()
+		if err == nil {
+			return candles, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %v", name, err))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if len(errs) == 0 {
+		return nil, fmt.Errorf("no provider has daily candles for %s", stock.Symbol)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// storedDaily brings the stored daily candles of a listing up to date and
+// returns its chart for a long-range period. Offline, the chart ends with the
+// last stored day
+func (m *MarketData) storedDaily(ctx context.Context, stock *models.Stock, period string) (*YahooData, error) {
+	if _, err := m.Backfill(ctx, stock, chartStart(period, time.Now())); err != nil {
+		log.Printf("Warning: Failed to update stored candles of %s, serving them as they are: %v", stock.Symbol, err)
+	}
+	if data, ok := m.storedHistory(stock, period); ok {
+		return data, nil
+	}
+	return nil, fmt.Errorf("no stored candles for %s", stock.Symbol)
+}
+
+// storedHistory returns the chart of a period from the candle store, ending
+// with the last stored candle
+func (m *MarketData) storedHistory(stock *models.Stock, period string) (*YahooData, bool) {
+	if m.store == nil {
+		return nil, false
+	}
+	intervals := intradayIntervals[period]
+	if dailyPeriods[period] {
+		intervals = []string{IntervalDaily}
+	}
+
+	for _, interval := range intervals {
+		last, ok, err := m.store.Last(stock.Symbol, stock.Exchange, interval)
+		if err != nil || !ok {
+			continue
+		}
+		end, err := candleTime(last.Date)
+		if err != nil {
+			continue
+		}
+		from := chartStart(period, end)
+		candles, err := m.store.Range(stock.Symbol, stock.Exchange, interval, from, end)
+		if err != nil || len(candles) == 0 {
+			continue
+		}
+
+		data := &YahooData{
+			CurrentPrice:     last.Price,
+			PreviousDayClose: candles[0].Open,
+			History:          candles,
+			Interval:         interval,
+		}
+		// The close of the day before the chart starts
+		if previous, ok, _ := m.store.Before(stock.Symbol, stock.Exchange, IntervalDaily, from); ok {
+			data.PreviousDayClose = previous.Price
+		}
+		// Five years are charted by the week, as Yahoo Finance charts them
+		if period == "5Y" {
+			data.History, data.Interval = weeklyCandles(candles), "1wk"
+		}
+		return data, true
+	}
+	return nil, false
+}
+
+// weeklyCandles merges daily candles into weekly ones, dated by their first day
+func weeklyCandles(daily []PricePoint) []PricePoint {
+	var weeks []PricePoint
+	current := 0
+	for _, day := range daily {
+		t, err := candleTime(day.Date)
+		if err != nil {
+			continue
+		}
+		year, week := t.ISOWeek()
+		if key := year*100 + week; len(weeks) == 0 || key != current {
+			weeks = append(weeks, day)
+			current = key
+			continue
+		}
+		w := &weeks[len(weeks)-1]
+		w.High = math.Max(w.High, day.High)
+		w.Low = math.Min(w.Low, day.Low)
+		w.Close, w.Price = day.Close, day.Price
+		w.Volume += day.Volume
+	}
+	return weeks
+}
@@ -0,0 +1,197 @@
+package api
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// IntervalDaily is the interval of daily candles. Other intervals are named as
+// Yahoo Finance names them, e.g. 5m or 1h
+const IntervalDaily = "1d"
+
+// coverageBucket records, per series, the earliest day its history is complete from
+var coverageBucket = []byte("coverage")
+
+// CandleStore keeps the candles of each listing on disk, one series per
+// interval, in a bbolt database. Daily candles are keyed by day, so a day
+// fetched again replaces the earlier, possibly partial, candle. It is safe for
+// concurrent use; only one process can open the database at a time
+type CandleStore struct {
+	db *bolt.DB
+}
+
+// OpenCandleStore opens the candle database at filePath, creating it if needed
+func OpenCandleStore(filePath string) (*CandleStore, error) {
+	db, err := bolt.Open(filePath, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open candle store %s: %v", filePath, err)
+	}
+	return &CandleStore{db: db}, nil
+}
+
+func (s *CandleStore) Close() error {
+	return s.db.Close()
+}
+
+// seriesName names the candles of a listing in an interval bucket
+func seriesName(symbol, exchange string) []byte {
+	return []byte(strings.ToUpper(exchange) + ":" + strings.ToUpper(symbol))
+}
+
+// candleTime reads the date of a candle: RFC3339 for intraday candles, else
+// YYYY-MM-DD
+func candleTime(date string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, date); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", date)
+}
+
+// storeKey returns the key of a time in a series: the day, at midnight UTC, for
+// daily candles
+func storeKey(interval string, t time.Time) []byte {
+	if interval == IntervalDaily {
+		t, _ = time.Parse("2006-01-02", t.Format("2006-01-02"))
+	}
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(t.Unix()))
+	return key
+}
+
+// Put stores candles fetched for the range starting at from. The store keeps the
+// earliest such start, for Coverage
+func (s *CandleStore) Put(symbol, exchange, interval string, from time.Time, candles []PricePoint) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		intervalBucket, err := tx.CreateBucketIfNotExists([]byte(interval))
+		if err != nil {
+			return err
+		}
+		series, err := intervalBucket.CreateBucketIfNotExists(seriesName(symbol, exchange))
+		if err != nil {
+			return err
+		}
+		for _, candle := range candles {
+			t, err := candleTime(candle.Date)
+			if err != nil {
+				continue
+			}
+			if interval == IntervalDaily {
+				candle.Date = t.Format("2006-01-02")
+			}
+			value, err := json.Marshal(candle)
+			if err != nil {
+				return err
+			}
+			if err := series.Put(storeKey(interval, t), value); err != nil {
+				return err
+			}
+		}
+
+		coverage, err := tx.CreateBucketIfNotExists(coverageBucket)
+		if err != nil {
+			return err
+		}
+		name := []byte(interval + "/" + string(seriesName(symbol, exchange)))
+		if current := coverage.Get(name); current == nil || string(storeKey(interval, from)) < string(current) {
+			return coverage.Put(name, storeKey(interval, from))
+		}
+		return nil
+	})
+}
+
+// series returns the bucket of a listing's candles, or nil if none are stored
+func series(tx *bolt.Tx, symbol, exchange, interval string) *bolt.Bucket {
+	intervalBucket := tx.Bucket([]byte(interval))
+	if intervalBucket == nil {
+		return nil
+	}
+	return intervalBucket.Bucket(seriesName(symbol, exchange))
+}
+
+// Range returns the stored candles from from to to, inclusive, oldest first
+func (s *CandleStore) Range(symbol, exchange, interval string, from, to time.Time) ([]PricePoint, error) {
+	var candles []PricePoint
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := series(tx, symbol, exchange, interval)
+		if b == nil {
+			return nil
+		}
+		end := string(storeKey(interval, to))
+		c := b.Cursor()
+		for k, v := c.Seek(storeKey(interval, from)); k != nil && string(k) <= end; k, v = c.Next() {
+			var candle PricePoint
+			if err := json.Unmarshal(v, &candle); err != nil {
+				return err
+			}
+			candles = append(candles, candle)
+		}
+		return nil
+	})
+	return candles, err
+}
+
+// Last returns the latest stored candle
+func (s *CandleStore) Last(symbol, exchange, interval string) (PricePoint, bool, error) {
+	var candle PricePoint
+	var ok bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := series(tx, symbol, exchange, interval)
+		if b == nil {
+			return nil
+		}
+		if _, v := b.Cursor().Last(); v != nil {
+			ok = true
+			return json.Unmarshal(v, &candle)
+		}
+		return nil
+	})
+	return candle, ok, err
+}
+
+// Before returns the latest stored candle before t
+func (s *CandleStore) Before(symbol, exchange, interval string, t time.Time) (PricePoint, bool, error) {
+	var candle PricePoint
+	var ok bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := series(tx, symbol, exchange, interval)
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		var v []byte
+		if k, _ := c.Seek(storeKey(interval, t)); k == nil {
+			_, v = c.Last()
+		} else {
+			_, v = c.Prev()
+		}
+		if v != nil {
+			ok = true
+			return json.Unmarshal(v, &candle)
+		}
+		return nil
+	})
+	return candle, ok, err
+}
+
+// Coverage returns the earliest day from which the stored history of a listing
+// is complete, as far as its providers had it
+func (s *CandleStore) Coverage(symbol, exchange, interval string) (time.Time, bool, error) {
+	var from time.Time
+	var ok bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		coverage := tx.Bucket(coverageBucket)
+		if coverage == nil {
+			return nil
+		}
+		if v := coverage.Get([]byte(interval + "/" + string(seriesName(symbol, exchange)))); len(v) == 8 {
+			from, ok = time.Unix(int64(binary.BigEndian.Uint64(v)), 0).UTC(), true
+		}
+		return nil
+	})
+	return from, ok, err
+}
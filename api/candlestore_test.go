@@ -0,0 +1,154 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"stock-search/models"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testDailyProvider serves a fixed daily history, recording the ranges asked for
+type testDailyProvider struct {
+	mu      sync.Mutex
+	days    []PricePoint
+	froms   []string
+	offline bool
+}
+
+func (p *testDailyProvider) Name() string { return "test_daily" }
+
+func (p *testDailyProvider) Fetch(ctx context.Context, stock *models.Stock, period string) (*YahooData, error) {
+	return nil, ErrUnsupported
+}
+
+func (p *testDailyProvider) FetchDaily(ctx context.Context, stock *models.Stock, from, to time.Time) ([]PricePoint, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.offline {
+		return nil, errors.New("network is unreachable")
+	}
+	p.froms = append(p.froms, from.Format("2006-01-02"))
+	var candles []PricePoint
+	for _, day := range p.days {
+		if day.Date >= from.Format("2006-01-02") && day.Date <= to.Format("2006-01-02") {
+			candles = append(candles, day)
+		}
+	}
+	return candles, nil
+}
+
+func (p *testDailyProvider) lastFrom() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.froms[len(p.froms)-1]
+}
+
+func openTestStore(t *testing.T) *CandleStore {
+	store, err := OpenCandleStore(filepath.Join(t.TempDir(), "candles.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestCandleStore(t *testing.T) {
+	store := openTestStore(t)
+	from := time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC)
+
+	// Angel One dates daily candles at midnight IST, Yahoo Finance by day: both
+	// are the same day
+	if err := store.Put("RELIANCE", "NSE", IntervalDaily, from, []PricePoint{
+		newCandle("2025-06-02T00:00:00+05:30", 1420, 1431, 1415, 1425, 100),
+		newCandle("2025-06-03T00:00:00+05:30", 1425, 1440, 1421, 1436, 200),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put("reliance", "nse", IntervalDaily, from, []PricePoint{newCandle("2025-06-03", 1425, 1442, 1421, 1439, 250)}); err != nil {
+		t.Fatal(err)
+	}
+
+	candles, err := store.Range("RELIANCE", "NSE", IntervalDaily, from, from.AddDate(0, 0, 7))
+	if err != nil || len(candles) != 2 {
+		t.Fatalf("Expected 2 daily candles, got %+v, %v", candles, err)
+	}
+	if candles[0].Date != "2025-06-02" || candles[1].Close != 1439 {
+		t.Errorf("Expected candles by day with the latest fetch of each, got %+v", candles)
+	}
+
+	if last, ok, _ := store.Last("RELIANCE", "NSE", IntervalDaily); !ok || last.Date != "2025-06-03" {
+		t.Errorf("Expected the last candle on 2025-06-03, got %+v", last)
+	}
+	if before, ok, _ := store.Before("RELIANCE", "NSE", IntervalDaily, from.AddDate(0, 0, 1)); !ok || before.Date != "2025-06-02" {
+		t.Errorf("Expected the candle before 2025-06-03 on 2025-06-02, got %+v", before)
+	}
+	if _, ok, _ := store.Before("RELIANCE", "NSE", IntervalDaily, from); ok {
+		t.Error("Expected no candle before the first one")
+	}
+	if _, ok, _ := store.Last("TCS", "NSE", IntervalDaily); ok {
+		t.Error("Expected no candles for an unknown listing")
+	}
+	if covered, ok, _ := store.Coverage("RELIANCE", "NSE", IntervalDaily); !ok || !covered.Equal(from) {
+		t.Errorf("Expected coverage from %s, got %s", from, covered)
+	}
+}
+
+func TestStoredHistory(t *testing.T) {
+	now := time.Now()
+	provider := &testDailyProvider{}
+	for d := now.AddDate(-6, 0, 0); !d.After(now); d = d.AddDate(0, 0, 1) {
+		provider.days = append(provider.days, newCandle(d.Format("2006-01-02"), 100, 102, 99, 101, 1000))
+	}
+	registerTestProvider(t, provider)
+
+	marketData, err := NewMarketData(MarketDataConfig{Chains: map[string][]string{"default": {"test_daily", "mock"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	marketData.SetCandleStore(openTestStore(t))
+	stock := &models.Stock{Symbol: "TCS", Exchange: "NSE"}
+
+	oneYearAgo := now.AddDate(-1, 0, 0)
+	if n, err := marketData.Backfill(context.Background(), stock, oneYearAgo); err != nil || n < 365 {
+		t.Fatalf("Expected a year of candles, got %d, %v", n, err)
+	}
+
+	// A stored period only fetches the days since the last stored one
+	data, source, err := marketData.Fetch(context.Background(), stock, "6M", "")
+	if err != nil || source != storeProvider || len(data.History) < 180 {
+		t.Fatalf("Expected six months from the store, got %q, %d candles, %v", source, len(data.History), err)
+	}
+	if from := provider.lastFrom(); from != now.Format("2006-01-02") {
+		t.Errorf("Expected only today to be fetched, got a fetch from %s", from)
+	}
+
+	// A period reaching past the stored history fetches all of it, by the week
+	data, _, err = marketData.Fetch(context.Background(), stock, "5Y", "")
+	if err != nil || len(data.History) < 250 || len(data.History) > 262 {
+		t.Fatalf("Expected five years of weekly candles, got %d, %v", len(data.History), err)
+	}
+	if from := provider.lastFrom(); from != now.AddDate(-5, 0, 0).Format("2006-01-02") {
+		t.Errorf("Expected five years to be fetched, got a fetch from %s", from)
+	}
+	if week := data.History[1]; week.Open != 100 || week.Close != 101 || week.High != 102 || week.Volume < 5000 {
+		t.Errorf("Expected a week merged from its days, got %+v", week)
+	}
+
+	// Offline, stored candles are served instead of placeholder prices
+	provider.mu.Lock()
+	provider.offline = true
+	provider.mu.Unlock()
+	data, source, err = marketData.Fetch(context.Background(), stock, "1Y", "")
+	if err != nil || source != storeProvider || len(data.History) < 365 {
+		t.Fatalf("Expected a year from the store offline, got %q, %v", source, err)
+	}
+	if data.CurrentPrice != 101 || data.PreviousDayClose != 101 {
+		t.Errorf("Expected prices from the stored closes, got %+v", data)
+	}
+	if _, source, _ := marketData.Fetch(context.Background(), &models.Stock{Symbol: "INFY", Exchange: "NSE"}, "1Y", ""); source != "mock" {
+		t.Errorf("Expected placeholder prices for a listing without stored candles, got %q", source)
+	}
+}
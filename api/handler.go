@@ -1,25 +1,32 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
+	"log"
+	"math"
 	"net/http"
-	"net/http/cookiejar"
 	"net/url"
-	"stock-search/credentials"
+	"stock-search/loader"
 	"stock-search/models"
 	"stock-search/search"
+	"strconv"
 	"strings"
 	"time"
 )
 
 type Handler struct {
-	Engine search.SearchEngine
+	Engine     search.SearchEngine
+	Securities *loader.SecurityMaster
+	Scrips     *loader.ScripMaster
+	Contracts  *search.ContractIndex
+	MarketData *MarketData
 }
 
-func NewHandler(engine search.SearchEngine) *Handler {
-	return &Handler{Engine: engine}
+func NewHandler(engine search.SearchEngine, securities *loader.SecurityMaster, scrips *loader.ScripMaster, contracts *search.ContractIndex, marketData *MarketData) *Handler {
+	return &Handler{Engine: engine, Securities: securities, Scrips: scrips, Contracts: contracts, MarketData: marketData}
 }
 
 func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
@@ -29,12 +36,126 @@ func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	results := h.Engine.Search(query)
+	opts, err := parseSearchOptions(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	results, err := h.Engine.Search(query, opts)
+	if errors.Is(err, search.ErrInvalidOptions) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Search error: %v", err)
+		http.Error(w, "Search failed", http.StatusInternalServerError)
+		return
+	}
+
+	// Derivative shorthand such as "RELIANCE FUT DEC" also lists the matching
+	// contracts, when its underlying is a listed stock or index
+	if derivative, ok := search.ParseDerivativeQuery(query); ok && h.Contracts != nil {
+		for _, group := range h.Contracts.Search(derivative, opts.Limit) {
+			if group.Listing = h.Engine.GetBySymbol(group.Underlying); group.Listing != nil {
+				results.Derivatives = append(results.Derivatives, group)
+			}
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(results)
 }
 
+// parseSearchOptions reads the limit, offset, sort, profile, group, explain, listing date,
+// include_inactive and filter query parameters.
+// A filter may be repeated or comma-separated: exchange=NSE&exchange=BSE or exchange=NSE,BSE
+func parseSearchOptions(params url.Values) (search.SearchOptions, error) {
+	var opts search.SearchOptions
+	var err error
+
+	if limit := params.Get("limit"); limit != "" {
+		if opts.Limit, err = strconv.Atoi(limit); err != nil {
+			return opts, fmt.Errorf("invalid limit parameter: %q", limit)
+		}
+	}
+	if offset := params.Get("offset"); offset != "" {
+		if opts.Offset, err = strconv.Atoi(offset); err != nil {
+			return opts, fmt.Errorf("invalid offset parameter: %q", offset)
+		}
+	}
+	opts.Sort = params.Get("sort")
+	opts.Profile = params.Get("profile")
+	opts.Group = params.Get("group")
+	opts.ListedAfter = params.Get("listed_after")
+	opts.ListedBefore = params.Get("listed_before")
+	opts.Explain = params.Get("explain") == "true"
+	opts.IncludeInactive = params.Get("include_inactive") == "true"
+
+	for _, field := range search.FilterFields {
+		for _, value := range params[field] {
+			for _, v := range strings.Split(value, ",") {
+				if v = strings.TrimSpace(v); v != "" {
+					if opts.Filters == nil {
+						opts.Filters = make(map[string][]string)
+					}
+					opts.Filters[field] = append(opts.Filters[field], v)
+				}
+			}
+		}
+	}
+
+	return opts.Normalize()
+}
+
+// Suggest returns autocomplete completions for a partially typed query
+func (h *Handler) Suggest(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		http.Error(w, "Missing query parameter 'q'", http.StatusBadRequest)
+		return
+	}
+
+	limit := search.DefaultSuggestLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > search.MaxSuggestLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", search.MaxSuggestLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	response := struct {
+		Query       string              `json:"query"`
+		Suggestions []search.Suggestion `json:"suggestions"`
+	}{
+		Query:       query,
+		Suggestions: h.Engine.Suggest(query, limit),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetSecurity returns a company's security master entry: its ISIN with the NSE
+// symbol, BSE scrip code, Yahoo ticker and Angel One token of each listing
+func (h *Handler) GetSecurity(w http.ResponseWriter, r *http.Request) {
+	isin := r.PathValue("isin")
+	if isin == "" {
+		http.Error(w, "Missing ISIN", http.StatusBadRequest)
+		return
+	}
+
+	security, ok := h.Securities.Get(isin)
+	if !ok {
+		http.Error(w, "Security not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(security)
+}
+
 func (h *Handler) GetStock(w http.ResponseWriter, r *http.Request) {
 	symbol := r.URL.Query().Get("symbol")
 	if symbol == "" {
@@ -63,62 +184,66 @@ func (h *Handler) GetStock(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get data provider parameter (default to yahoo)
-	provider := r.URL.Query().Get("provider")
-	if provider == "" {
-		provider = "yahoo"
+	// Every listing reports a status, for the badge in the detail view
+	if stock.Status == "" {
+		active := *stock
+		active.Status = models.StatusActive
+		stock = &active
 	}
 
-	var stockData *YahooData
-	var err error
-
-	// Try Angel One if selected
-	if provider == "angelone" {
-		// Use environment variable provider by default
-		// Users can replace this with KMS provider
-		credProvider := credentials.NewEnvProvider()
-		stockData, err = FetchAngelOneData(stock.Symbol, stock.Exchange, period, credProvider)
-
-		if err != nil {
-			// Fallback to Yahoo Finance
-			fmt.Printf("Angel One failed (%v), falling back to Yahoo Finance\n", err)
-			stockData, err = fetchYahooData(stock.Symbol, stock.Exchange, period)
-		}
-	} else {
-		// Use Yahoo Finance
-		stockData, err = fetchYahooData(stock.Symbol, stock.Exchange, period)
+	// The provider parameter, if set, is tried before the listing's fallback chain
+	stockData, provider, err := h.MarketData.Fetch(r.Context(), stock, period, r.URL.Query().Get("provider"))
+	if errors.Is(err, ErrUnknownProvider) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-
 	if err != nil {
-		// Fallback to mock data if both providers fail
-		fmt.Println("Error fetching data:", err)
-		serveMockData(w, stock, period)
+		log.Printf("Market data error: %v", err)
+		http.Error(w, "No market data available", http.StatusBadGateway)
 		return
 	}
 
+	// history=close keeps the {date, price} points of clients that predate candles
+	history := stockData.History
+	if r.URL.Query().Get("history") == "close" {
+		history = closeOnly(history)
+	}
+
 	response := struct {
 		*models.Stock
 		CurrentPrice     float64      `json:"currentPrice"`
 		PreviousDayClose float64      `json:"previousDayClose"` // Closing price of day before chart starts
 		History          []PricePoint `json:"history"`
+		Provider         string       `json:"provider"` // market data provider that answered, "mock" for placeholder prices
 	}{
 		Stock:            stock,
 		CurrentPrice:     stockData.CurrentPrice,
 		PreviousDayClose: stockData.PreviousDayClose,
-		History:          stockData.History,
+		History:          history,
+		Provider:         provider,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
-func serveMockData(w http.ResponseWriter, stock *models.Stock, period string) {
-	// Mock Price Data (Fallback)
+// mockData generates placeholder prices for a listing
+func mockData(stock *models.Stock, period string) *YahooData {
 	currentPrice := 1000.0 + (float64(len(stock.Symbol)) * 10.5)
 
 	var history []PricePoint
 	basePrice := currentPrice * 0.9
 
+	// Each candle opens at the close of the one before
+	addCandle := func(date string, price float64) {
+		open := price
+		if len(history) > 0 {
+			open = history[len(history)-1].Close
+		}
+		volume := int64(10000 + len(history)%7*2500)
+		history = append(history, newCandle(date, open, math.Max(open, price)*1.002, math.Min(open, price)*0.998, price, volume))
+	}
+
 	// Generate mock data based on period granularity
 	switch period {
 	case "1D":
@@ -130,7 +255,7 @@ func serveMockData(w http.ResponseWriter, stock *models.Stock, period string) {
 				fluctuation = -fluctuation
 			}
 			price := basePrice + fluctuation + (float64(i) * 0.1)
-			history = append(history, PricePoint{Date: timestamp.Format(time.RFC3339), Price: price})
+			addCandle(timestamp.Format(time.RFC3339), price)
 		}
 	case "1W", "1M":
 		// Hourly intervals
@@ -145,7 +270,7 @@ func serveMockData(w http.ResponseWriter, stock *models.Stock, period string) {
 				fluctuation = -fluctuation
 			}
 			price := basePrice + fluctuation + (float64(i) * 0.05)
-			history = append(history, PricePoint{Date: timestamp.Format(time.RFC3339), Price: price})
+			addCandle(timestamp.Format(time.RFC3339), price)
 		}
 	default:
 		// Daily intervals for 6M, 1Y, 5Y
@@ -166,24 +291,15 @@ func serveMockData(w http.ResponseWriter, stock *models.Stock, period string) {
 				fluctuation = -fluctuation
 			}
 			price := basePrice + fluctuation + (float64(i) * 0.5)
-			history = append(history, PricePoint{Date: date, Price: price})
+			addCandle(date, price)
 		}
 	}
 
-	response := struct {
-		*models.Stock
-		CurrentPrice     float64      `json:"currentPrice"`
-		PreviousDayClose float64      `json:"previousDayClose"`
-		History          []PricePoint `json:"history"`
-	}{
-		Stock:            stock,
+	return &YahooData{
 		CurrentPrice:     currentPrice,
 		PreviousDayClose: basePrice, // Mock previous close as basePrice
 		History:          history,
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
 }
 
 // Yahoo Finance Structures
@@ -198,25 +314,65 @@ type YahooChartResponse struct {
 			Timestamp  []int64 `json:"timestamp"`
 			Indicators struct {
 				Quote []struct {
-					Close []float64 `json:"close"`
+					Open   []float64 `json:"open"`
+					High   []float64 `json:"high"`
+					Low    []float64 `json:"low"`
+					Close  []float64 `json:"close"`
+					Volume []int64   `json:"volume"`
 				} `json:"quote"`
 			} `json:"indicators"`
 		} `json:"result"`
+		Error *struct {
+			Code        string `json:"code"`
+			Description string `json:"description"`
+		} `json:"error"`
 	} `json:"chart"`
 }
 
+// PricePoint is one candle of a price history. Price is the close, kept for
+// clients that only chart closing prices
 type PricePoint struct {
-	Date  string  `json:"date"`
-	Price float64 `json:"price"`
+	Date   string  `json:"date"`
+	Price  float64 `json:"price"`
+	Open   float64 `json:"open,omitempty"`
+	High   float64 `json:"high,omitempty"`
+	Low    float64 `json:"low,omitempty"`
+	Close  float64 `json:"close,omitempty"`
+	Volume int64   `json:"volume,omitempty"`
+}
+
+// newCandle returns a candle, taking the close for an open, high or low the
+// provider left out
+func newCandle(date string, open, high, low, close float64, volume int64) PricePoint {
+	if open == 0 {
+		open = close
+	}
+	if high == 0 {
+		high = math.Max(open, close)
+	}
+	if low == 0 {
+		low = math.Min(open, close)
+	}
+	return PricePoint{Date: date, Price: close, Open: open, High: high, Low: low, Close: close, Volume: volume}
+}
+
+// closeOnly strips a history down to dates and closing prices
+func closeOnly(history []PricePoint) []PricePoint {
+	points := make([]PricePoint, len(history))
+	for i, point := range history {
+		points[i] = PricePoint{Date: point.Date, Price: point.Price}
+	}
+	return points
 }
 
 type YahooData struct {
 	CurrentPrice     float64
 	PreviousDayClose float64 // Closing price of day before chart starts
 	History          []PricePoint
+	Interval         string // candle length, e.g. 5m or 1d; empty for placeholder prices, which are not stored
 }
 
-func fetchYahooData(symbol string, exchange string, period string) (*YahooData, error) {
+func fetchYahooData(ctx context.Context, session *YahooSession, ticker string, period string) (*YahooData, error) {
 	// Map period to Yahoo Finance parameters
 	var yahooRange, yahooInterval string
 	switch period {
@@ -246,83 +402,29 @@ func fetchYahooData(symbol string, exchange string, period string) (*YahooData,
 		yahooInterval = "5m"
 	}
 
-	// Yahoo Finance requires exchange-specific suffix
-	// .NS for NSE, .BO for BSE
-	var suffix string
-	if exchange == "BSE" {
-		suffix = ".BO"
-	} else {
-		suffix = ".NS" // Default to NSE
-	}
-
-	// URL encode the symbol to handle special characters like '&' (e.g. M&M)
-	yahooSymbol := url.QueryEscape(symbol + suffix)
-
-	jar, _ := cookiejar.New(nil)
-	client := &http.Client{
-		Jar:     jar,
-		Timeout: 10 * time.Second,
-	}
-
-	// 1. Get Cookie from main page
-	req, _ := http.NewRequest("GET", "https://finance.yahoo.com", nil)
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
-	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		fmt.Printf("Error fetching cookie for %s: %v\n", symbol, err)
-		return nil, fmt.Errorf("failed to get cookie: %v", err)
-	}
-	resp.Body.Close()
-
-	// 2. Get Crumb
-	req, _ = http.NewRequest("GET", "https://query1.finance.yahoo.com/v1/test/getcrumb", nil)
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
-	req.Header.Set("Origin", "https://finance.yahoo.com")
-	req.Header.Set("Referer", "https://finance.yahoo.com/")
+	return fetchYahooChart(ctx, session, ticker, "range="+yahooRange, yahooInterval)
+}
 
-	resp, err = client.Do(req)
+// fetchYahooDaily fetches the daily candles of a date range
+func fetchYahooDaily(ctx context.Context, session *YahooSession, ticker string, from, to time.Time) ([]PricePoint, error) {
+	data, err := fetchYahooChart(ctx, session, ticker, fmt.Sprintf("period1=%d&period2=%d", from.Unix(), to.Unix()), IntervalDaily)
 	if err != nil {
-		fmt.Printf("Error fetching crumb for %s: %v\n", symbol, err)
-		return nil, fmt.Errorf("failed to get crumb: %v", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
-	body, _ := io.ReadAll(resp.Body)
-	crumb := string(body)
-
-	if strings.Contains(crumb, "html") {
-		fmt.Printf("Invalid crumb for %s: %s\n", symbol, crumb)
-		return nil, fmt.Errorf("invalid crumb received")
-	}
-
-	// 3. Get Chart Data with dynamic range and interval
-	url := fmt.Sprintf("https://query1.finance.yahoo.com/v8/finance/chart/%s?symbol=%s&range=%s&interval=%s&crumb=%s",
-		yahooSymbol, yahooSymbol, yahooRange, yahooInterval, crumb)
-
-	req, _ = http.NewRequest("GET", url, nil)
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
+	return data.History, nil
+}
 
-	resp, err = client.Do(req)
+// fetchYahooChart fetches the candles of a ticker over span, either range= or
+// period1= and period2= parameters
+func fetchYahooChart(ctx context.Context, session *YahooSession, ticker, span, yahooInterval string) (*YahooData, error) {
+	yahooResp, err := session.chart(ctx, ticker, span, yahooInterval)
 	if err != nil {
-		fmt.Printf("Error fetching chart for %s: %v\n", symbol, err)
-		return nil, fmt.Errorf("failed to fetch chart: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		fmt.Printf("Yahoo API error for %s: Status %s\n", symbol, resp.Status)
-		return nil, fmt.Errorf("yahoo api returned status: %s", resp.Status)
-	}
-
-	var yahooResp YahooChartResponse
-	if err := json.NewDecoder(resp.Body).Decode(&yahooResp); err != nil {
-		fmt.Printf("JSON decode error for %s: %v\n", symbol, err)
-		return nil, fmt.Errorf("failed to decode json: %v", err)
+		fmt.Printf("Error fetching chart for %s: %v\n", ticker, err)
+		return nil, err
 	}
 
 	if len(yahooResp.Chart.Result) == 0 {
-		fmt.Printf("No result in Yahoo response for %s\n", symbol)
+		fmt.Printf("No result in Yahoo response for %s\n", ticker)
 		return nil, fmt.Errorf("no result in yahoo response")
 	}
 
@@ -332,13 +434,23 @@ func fetchYahooData(symbol string, exchange string, period string) (*YahooData,
 
 	var history []PricePoint
 	timestamps := result.Timestamp
-	closes := result.Indicators.Quote[0].Close
+	if len(result.Indicators.Quote) == 0 {
+		return nil, fmt.Errorf("no quotes in yahoo response")
+	}
+	quote := result.Indicators.Quote[0]
+	// Missing values are null, decoded as 0
+	at := func(values []float64, i int) float64 {
+		if i < len(values) {
+			return values[i]
+		}
+		return 0
+	}
 
 	// Format timestamps based on interval (intraday vs daily/weekly)
 	isIntraday := yahooInterval == "5m" || yahooInterval == "30m" || yahooInterval == "60m"
 
 	for i, ts := range timestamps {
-		if i < len(closes) && closes[i] != 0 {
+		if close := at(quote.Close, i); close != 0 {
 			var dateStr string
 			if isIntraday {
 				// For intraday data, include time in RFC3339 format
@@ -347,7 +459,11 @@ func fetchYahooData(symbol string, exchange string, period string) (*YahooData,
 				// For daily data, use date only
 				dateStr = time.Unix(ts, 0).Format("2006-01-02")
 			}
-			history = append(history, PricePoint{Date: dateStr, Price: closes[i]})
+			var volume int64
+			if i < len(quote.Volume) {
+				volume = quote.Volume[i]
+			}
+			history = append(history, newCandle(dateStr, at(quote.Open, i), at(quote.High, i), at(quote.Low, i), close, volume))
 		}
 	}
 
@@ -359,10 +475,8 @@ func fetchYahooData(symbol string, exchange string, period string) (*YahooData,
 
 		// If last point is more than 1 minute before regular market time, append regular market price
 		if regularTime.Sub(lastTime) > 1*time.Minute {
-			history = append(history, PricePoint{
-				Date:  regularTime.Format(time.RFC3339),
-				Price: result.Meta.RegularMarketPrice,
-			})
+			price := result.Meta.RegularMarketPrice
+			history = append(history, newCandle(regularTime.Format(time.RFC3339), price, price, price, price, 0))
 		}
 	}
 
@@ -375,5 +489,6 @@ func fetchYahooData(symbol string, exchange string, period string) (*YahooData,
 		CurrentPrice:     currentPrice,
 		PreviousDayClose: previousDayClose,
 		History:          history,
+		Interval:         yahooInterval,
 	}, nil
 }
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"stock-search/models"
+	"stock-search/search"
+	"testing"
+)
+
+func TestCandles(t *testing.T) {
+	// A provider without open, high or low gets a flat candle at the close
+	flat := newCandle("2025-01-02", 0, 0, 0, 100, 0)
+	if flat.Open != 100 || flat.High != 100 || flat.Low != 100 || flat.Price != 100 {
+		t.Errorf("Expected a flat candle at 100, got %+v", flat)
+	}
+
+	data := mockData(&models.Stock{Symbol: "TCS", Exchange: "NSE"}, "1M")
+	for i, candle := range data.History {
+		if candle.Price != candle.Close || candle.High < candle.Open || candle.High < candle.Close ||
+			candle.Low > candle.Open || candle.Low > candle.Close || candle.Volume == 0 {
+			t.Fatalf("Inconsistent candle %d: %+v", i, candle)
+		}
+		if i > 0 && candle.Open != data.History[i-1].Close {
+			t.Fatalf("Expected candle %d to open at the previous close, got %+v", i, candle)
+		}
+	}
+
+	// The close-only history keeps the {date, price} shape of earlier clients
+	body, err := json.Marshal(closeOnly([]PricePoint{newCandle("2025-01-02", 99, 101, 98, 100, 5000)}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `[{"date":"2025-01-02","price":100}]`; string(body) != want {
+		t.Errorf("Expected %s, got %s", want, body)
+	}
+}
+
+func TestSearchDerivatives(t *testing.T) {
+	contracts := search.NewContractIndex()
+	contracts.Update([]models.Contract{
+		{Symbol: "RELIANCE30DEC99FUT", Underlying: "RELIANCE", InstrumentType: "FUTSTK", Expiry: "2099-12-30"},
+		{Symbol: "TATA30DEC99FUT", Underlying: "TATA", InstrumentType: "FUTSTK", Expiry: "2099-12-30"},
+	})
+	handler := &Handler{
+		Engine: search.NewInMemoryEngine([]models.Stock{
+			{Symbol: "FEL", Name: "Future Enterprises Limited", Exchange: "NSE"},
+			{Symbol: "ENTERPRISES", Name: "Enterprises Limited", Exchange: "NSE"},
+			{Symbol: "RELIANCE", Name: "Reliance Industries Limited", Exchange: "NSE"},
+		}),
+		Contracts: contracts,
+	}
+	find := func(query string) *search.SearchResult {
+		w := httptest.NewRecorder()
+		handler.Search(w, httptest.NewRequest("GET", "/search?q="+url.QueryEscape(query), nil))
+		var result search.SearchResult
+		if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+			t.Fatalf("%q: %v", query, err)
+		}
+		return &result
+	}
+
+	// Company names with derivative words are searched as typed
+	result := find("Future Enterprises")
+	if len(result.Results) != 1 || result.Results[0].Symbol != "FEL" || len(result.Derivatives) != 0 {
+		t.Errorf("Expected FEL without contracts, got %+v", result)
+	}
+
+	result = find("RELIANCE FUT")
+	if len(result.Derivatives) != 1 || result.Derivatives[0].Listing == nil || result.Derivatives[0].Listing.Symbol != "RELIANCE" {
+		t.Errorf("Expected the RELIANCE futures with their listing, got %+v", result.Derivatives)
+	}
+
+	// Contracts of an underlying that is not listed are left out
+	if result := find("TATA FUT"); len(result.Derivatives) != 0 {
+		t.Errorf("Expected no contracts for an unlisted underlying, got %+v", result.Derivatives)
+	}
+}
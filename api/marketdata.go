@@ -0,0 +1,362 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"stock-search/credentials"
+	"stock-search/loader"
+	"stock-search/models"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MarketDataProvider fetches the price history of a listing for a chart period
+// (1D, 1W, 1M, 6M, 1Y, YTD or 5Y)
+type MarketDataProvider interface {
+	Name() string
+	// Fetch returns ErrUnsupported, possibly wrapped, for listings the provider
+	// does not cover, so the next provider of the chain is tried
+	Fetch(ctx context.Context, stock *models.Stock, period string) (*YahooData, error)
+}
+
+// DailyCandleProvider is a provider that can also fetch the daily candles of a
+// date range, so stored histories are extended with just the days missing
+type DailyCandleProvider interface {
+	MarketDataProvider
+	FetchDaily(ctx context.Context, stock *models.Stock, from, to time.Time) ([]PricePoint, error)
+}
+
+var (
+	// ErrUnsupported is returned by providers for listings they do not cover
+	ErrUnsupported = errors.New("listing not supported by provider")
+	// ErrUnknownProvider is returned when a request names an unregistered provider
+	ErrUnknownProvider = errors.New("unknown market data provider")
+)
+
+var (
+	providersMu sync.RWMutex
+	providers   = make(map[string]MarketDataProvider)
+)
+
+// RegisterProvider makes a market data provider available to chains under its
+// name. It panics if the name is already taken
+func RegisterProvider(p MarketDataProvider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	if _, ok := providers[p.Name()]; ok {
+		panic("api: RegisterProvider called twice for " + p.Name())
+	}
+	providers[p.Name()] = p
+}
+
+func lookupProvider(name string) (MarketDataProvider, bool) {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	p, ok := providers[name]
+	return p, ok
+}
+
+// Built-in providers. Angel One needs the scrip master and credentials, so it is
+// registered by the server with NewAngelOneProvider
+func init() {
+	RegisterProvider(yahooProvider{session: NewYahooSession(yahooHomeURL, yahooQueryURL)})
+	RegisterProvider(mfapiProvider{})
+	RegisterProvider(mockProvider{})
+}
+
+// yahooProvider charts listings from Yahoo Finance, sharing one session
+type yahooProvider struct {
+	session *YahooSession
+}
+
+func (yahooProvider) Name() string { return "yahoo" }
+
+func (p yahooProvider) Fetch(ctx context.Context, stock *models.Stock, period string) (*YahooData, error) {
+	if stock.Exchange == models.ExchangeAMFI {
+		return nil, ErrUnsupported
+	}
+	return fetchYahooData(ctx, p.session, stock.ChartTicker(), period)
+}
+
+func (p yahooProvider) FetchDaily(ctx context.Context, stock *models.Stock, from, to time.Time) ([]PricePoint, error) {
+	if stock.Exchange == models.ExchangeAMFI {
+		return nil, ErrUnsupported
+	}
+	return fetchYahooDaily(ctx, p.session, stock.ChartTicker(), from, to)
+}
+
+type mfapiProvider struct{}
+
+func (mfapiProvider) Name() string { return "mfapi" }
+
+func (mfapiProvider) Fetch(ctx context.Context, stock *models.Stock, period string) (*YahooData, error) {
+	if stock.Type != models.TypeMutualFund {
+		return nil, ErrUnsupported
+	}
+	return fetchMFAPIData(ctx, stock.Symbol, period)
+}
+
+func (mfapiProvider) FetchDaily(ctx context.Context, stock *models.Stock, from, to time.Time) ([]PricePoint, error) {
+	if stock.Type != models.TypeMutualFund {
+		return nil, ErrUnsupported
+	}
+	return fetchMFAPIDaily(ctx, stock.Symbol, from, to)
+}
+
+// mockProvider generates placeholder prices, as a last resort
+type mockProvider struct{}
+
+func (mockProvider) Name() string { return "mock" }
+
+func (mockProvider) Fetch(ctx context.Context, stock *models.Stock, period string) (*YahooData, error) {
+	return mockData(stock, period), nil
+}
+
+type angelOneProvider struct {
+	scrips      *loader.ScripMaster
+	credentials credentials.Provider
+}
+
+// NewAngelOneProvider returns the Angel One provider, which finds listings in
+// the scrip master
+func NewAngelOneProvider(scrips *loader.ScripMaster, credProvider credentials.Provider) MarketDataProvider {
+	return angelOneProvider{scrips: scrips, credentials: credProvider}
+}
+
+func (angelOneProvider) Name() string { return "angelone" }
+
+func (p angelOneProvider) Fetch(ctx context.Context, stock *models.Stock, period string) (*YahooData, error) {
+	if p.scrips.Lookup(stock.Symbol, stock.Exchange) == "" {
+		return nil, fmt.Errorf("%w: no Angel One token for %s on %s", ErrUnsupported, stock.Symbol, stock.Exchange)
+	}
+	return FetchAngelOneData(ctx, stock.Symbol, stock.Exchange, period, p.scrips, p.credentials)
+}
+
+func (p angelOneProvider) FetchDaily(ctx context.Context, stock *models.Stock, from, to time.Time) ([]PricePoint, error) {
+	if p.scrips.Lookup(stock.Symbol, stock.Exchange) == "" {
+		return nil, fmt.Errorf("%w: no Angel One token for %s on %s", ErrUnsupported, stock.Symbol, stock.Exchange)
+	}
+	return FetchAngelOneDaily(ctx, stock.Symbol, stock.Exchange, from, to, p.scrips, p.credentials)
+}
+
+// defaultChain is the chain of exchanges without one of their own
+const defaultChain = "default"
+
+// defaultProviderTimeout applies to providers without a timeout of their own
+const defaultProviderTimeout = 10 * time.Second
+
+// MarketDataConfig chooses the providers tried for each exchange, in order,
+// and how long each may take
+type MarketDataConfig struct {
+	Timeout   string                    `json:"timeout,omitempty"` // per provider, e.g. "10s"
+	Providers map[string]ProviderConfig `json:"providers,omitempty"`
+	Chains    map[string][]string       `json:"chains"`              // keyed by exchange, or "default"
+	CacheTTL  map[string]string         `json:"cache_ttl,omitempty"` // keyed by chart period, e.g. "1D": "30s"
+}
+
+// ProviderConfig overrides the settings of one provider
+type ProviderConfig struct {
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// MarketData fetches prices through a fallback chain of providers, caching
+// each provider's answers
+type MarketData struct {
+	chains   map[string][]string
+	timeout  time.Duration
+	timeouts map[string]time.Duration
+	cache    *PriceCache
+	store    *CandleStore // optional, see SetCandleStore
+}
+
+// DefaultMarketData tries Yahoo Finance, or mfapi.in for mutual funds, then
+// falls back to mock prices
+func DefaultMarketData() *MarketData {
+	return &MarketData{
+		chains: map[string][]string{
+			defaultChain:        {"yahoo", "mock"},
+			models.ExchangeAMFI: {"mfapi", "mock"},
+		},
+		timeout:  defaultProviderTimeout,
+		timeouts: make(map[string]time.Duration),
+		cache:    NewPriceCache(nil),
+	}
+}
+
+// LoadMarketData reads a market data config. Every provider it names must be
+// registered
+func LoadMarketData(filePath string) (*MarketData, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var config MarketDataConfig
+	if err := json.NewDecoder(file).Decode(&config); err != nil {
+		return nil, err
+	}
+	return NewMarketData(config)
+}
+
+// NewMarketData validates a market data config
+func NewMarketData(config MarketDataConfig) (*MarketData, error) {
+	m := &MarketData{chains: config.Chains, timeout: defaultProviderTimeout, timeouts: make(map[string]time.Duration)}
+
+	parse := func(name, value string) (time.Duration, error) {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return 0, fmt.Errorf("%s: invalid timeout %q", name, value)
+		}
+		return timeout, nil
+	}
+	if config.Timeout != "" {
+		timeout, err := parse("market data", config.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		m.timeout = timeout
+	}
+	ttls := make(map[string]time.Duration)
+	for period, value := range config.CacheTTL {
+		ttl, err := parse("cache "+period, value)
+		if err != nil {
+			return nil, err
+		}
+		ttls[period] = ttl
+	}
+	m.cache = NewPriceCache(ttls)
+
+	for name, provider := range config.Providers {
+		if _, ok := lookupProvider(name); !ok {
+			return nil, fmt.Errorf("%w %q", ErrUnknownProvider, name)
+		}
+		if provider.Timeout != "" {
+			timeout, err := parse(name, provider.Timeout)
+			if err != nil {
+				return nil, err
+			}
+			m.timeouts[name] = timeout
+		}
+	}
+
+	if len(config.Chains[defaultChain]) == 0 {
+		return nil, fmt.Errorf("missing %q chain", defaultChain)
+	}
+	for exchange, chain := range config.Chains {
+		for _, name := range chain {
+			if _, ok := lookupProvider(name); !ok {
+				return nil, fmt.Errorf("chain %q: %w %q", exchange, ErrUnknownProvider, name)
+			}
+		}
+	}
+	return m, nil
+}
+
+// chain lists the providers tried for a listing: preferred, if set, then the
+// chain of its exchange
+func (m *MarketData) chain(exchange, preferred string) []string {
+	chain, ok := m.chains[exchange]
+	if !ok {
+		chain = m.chains[defaultChain]
+	}
+	if preferred == "" {
+		return chain
+	}
+	names := []string{preferred}
+	for _, name := range chain {
+		if name != preferred {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Fetch returns the price history of a listing from the first provider of its
+// chain that has it, with that provider's name. preferred, if set, is tried
+// first and must be a registered provider
+func (m *MarketData) Fetch(ctx context.Context, stock *models.Stock, period, preferred string) (*YahooData, string, error) {
+	if _, ok := lookupProvider(preferred); preferred != "" && !ok {
+		return nil, "", fmt.Errorf("%w %q", ErrUnknownProvider, preferred)
+	}
+
+	// Long-range charts come from the candle store, topped up with the days missing
+	if m.store != nil && preferred == "" && dailyPeriods[period] {
+		key := strings.Join([]string{storeProvider, stock.Symbol, stock.Exchange, period}, "|")
+		data, err := m.cache.Get(ctx, key, period, func() (*YahooData, error) {
+			return m.storedDaily(context.WithoutCancel(ctx), stock, period)
+		})
+		if err == nil {
+			return data, storeProvider, nil
+		}
+		log.Printf("Warning: No stored candles for %s (%v), trying the providers", stock.Symbol, err)
+	}
+
+	var errs []error
+	for _, name := range m.chain(stock.Exchange, preferred) {
+		provider, _ := lookupProvider(name)
+		data, err := m.fetch(ctx, provider, stock, period)
+		if err == nil {
+			// Stored prices beat placeholder ones, unless those were asked for
+			if data.Interval == "" && name != preferred {
+				if stored, ok := m.storedHistory(stock, period); ok {
+					return stored, storeProvider, nil
+				}
+			}
+			return data, name, nil
+		}
+		if !errors.Is(err, ErrUnsupported) {
+			fmt.Printf("%s failed for %s (%v), trying the next provider\n", name, stock.Symbol, err)
+		}
+		errs = append(errs, fmt.Errorf("%s: %v", name, err))
+		if ctx.Err() != nil {
+			break // the request was cancelled
+		}
+	}
+	// Offline, the stored history is served
+	if stored, ok := m.storedHistory(stock, period); ok {
+		return stored, storeProvider, nil
+	}
+	return nil, "", fmt.Errorf("no market data for %s: %v", stock.Symbol, errors.Join(errs...))
+}
+
+// fetch calls one provider through the cache, giving up once its timeout has
+// passed. Requests for a history already being fetched from the provider wait
+// for that fetch
+func (m *MarketData) fetch(ctx context.Context, provider MarketDataProvider, stock *models.Stock, period string) (*YahooData, error) {
+	timeout := m.providerTimeout(provider.Name())
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	key := strings.Join([]string{provider.Name(), stock.Symbol, stock.Exchange, period}, "|")
+	data, err := m.cache.Get(waitCtx, key, period, func() (*YahooData, error) {
+		// Not tied to this request, which others may be waiting on
+		fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+		defer cancel()
+		data, err := provider.Fetch(fetchCtx, stock, period)
+		if err == nil && m.store != nil && data.Interval != "" && len(data.History) > 0 {
+			from, _ := candleTime(data.History[0].Date)
+			if err := m.store.Put(stock.Symbol, stock.Exchange, data.Interval, from, data.History); err != nil {
+				log.Printf("Warning: Failed to store candles of %s: %v", stock.Symbol, err)
+			}
+		}
+		return data, err
+	})
+	if err != nil && ctx.Err() == nil && errors.Is(waitCtx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("timed out after %s", timeout)
+	}
+	return data, err
+}
+
+// providerTimeout returns how long a provider may take
+func (m *MarketData) providerTimeout(name string) time.Duration {
+	if timeout, ok := m.timeouts[name]; ok {
+		return timeout
+	}
+	return m.timeout
+}
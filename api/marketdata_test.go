@@ -0,0 +1,96 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"stock-search/models"
+	"testing"
+	"time"
+)
+
+// testProvider answers with a fixed price after a delay, or fails
+type testProvider struct {
+	name  string
+	price float64
+	delay time.Duration
+	err   error
+}
+
+func (p testProvider) Name() string { return p.name }
+
+func (p testProvider) Fetch(ctx context.Context, stock *models.Stock, period string) (*YahooData, error) {
+	select {
+	case <-time.After(p.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &YahooData{CurrentPrice: p.price}, nil
+}
+
+// registerTestProvider registers a provider until the end of the test
+func registerTestProvider(t *testing.T, p MarketDataProvider) {
+	t.Helper()
+	RegisterProvider(p)
+	t.Cleanup(func() {
+		providersMu.Lock()
+		defer providersMu.Unlock()
+		delete(providers, p.Name())
+	})
+}
+
+func TestMarketDataChain(t *testing.T) {
+	registerTestProvider(t, testProvider{name: "test_slow", price: 1, delay: time.Second})
+	registerTestProvider(t, testProvider{name: "test_unsupported", err: ErrUnsupported})
+	registerTestProvider(t, testProvider{name: "test_failing", err: errors.New("boom")})
+	registerTestProvider(t, testProvider{name: "test_fast", price: 2})
+
+	marketData, err := NewMarketData(MarketDataConfig{
+		Timeout:   "1s",
+		Providers: map[string]ProviderConfig{"test_slow": {Timeout: "20ms"}},
+		Chains: map[string][]string{
+			"default": {"test_unsupported", "test_fast"},
+			"NSE":     {"test_slow", "test_failing", "test_fast"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewMarketData failed: %v", err)
+	}
+
+	stock := &models.Stock{Symbol: "TCS", Exchange: "NSE"}
+	start := time.Now()
+	data, provider, err := marketData.Fetch(context.Background(), stock, "1D", "")
+	if err != nil || provider != "test_fast" || data.CurrentPrice != 2 {
+		t.Fatalf("Expected test_fast after the slow and failing providers, got %q, %+v, %v", provider, data, err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected the slow provider to time out after 20ms, took %s", elapsed)
+	}
+
+	// Exchanges without a chain use the default one
+	if _, provider, _ := marketData.Fetch(context.Background(), &models.Stock{Symbol: "500325", Exchange: "BSE"}, "1D", ""); provider != "test_fast" {
+		t.Errorf("Expected the default chain, got %q", provider)
+	}
+
+	// A preferred provider is tried first
+	if _, provider, _ := marketData.Fetch(context.Background(), stock, "1D", "mock"); provider != "mock" {
+		t.Errorf("Expected the preferred provider, got %q", provider)
+	}
+	if _, _, err := marketData.Fetch(context.Background(), stock, "1D", "bloomberg"); !errors.Is(err, ErrUnknownProvider) {
+		t.Errorf("Expected ErrUnknownProvider, got %v", err)
+	}
+
+	onlyFailing, _ := NewMarketData(MarketDataConfig{Chains: map[string][]string{"default": {"test_failing"}}})
+	if _, _, err := onlyFailing.Fetch(context.Background(), stock, "1D", ""); err == nil {
+		t.Error("Expected an error when every provider fails")
+	}
+
+	if _, err := NewMarketData(MarketDataConfig{Chains: map[string][]string{"NSE": {"test_fast"}}}); err == nil {
+		t.Error("Expected a config without a default chain to be rejected")
+	}
+	if _, err := NewMarketData(MarketDataConfig{Chains: map[string][]string{"default": {"reuters"}}}); !errors.Is(err, ErrUnknownProvider) {
+		t.Errorf("Expected an unknown provider to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// mfapiURL serves the NAV history of a mutual fund scheme by AMFI scheme code
+const mfapiURL = "https://api.mfapi.in/mf/"
+
+// MFAPIResponse is the NAV history of a scheme, newest first
+type MFAPIResponse struct {
+	Status string `json:"status"`
+	Data   []struct {
+		Date string `json:"date"` // DD-MM-YYYY
+		NAV  string `json:"nav"`
+	} `json:"data"`
+}
+
+// mfapiStart returns the first day of a chart period. NAVs are published once a
+// day, so 1D and 1W both show the last week
+func mfapiStart(period string, now time.Time) time.Time {
+	switch period {
+	case "1M":
+		return now.AddDate(0, -1, 0)
+	case "6M":
+		return now.AddDate(0, -6, 0)
+	case "1Y":
+		return now.AddDate(-1, 0, 0)
+	case "YTD":
+		return time.Date(now.Year(), time.January, 1, 0, 0, 0, 0, now.Location())
+	case "5Y":
+		return now.AddDate(-5, 0, 0)
+	default:
+		return now.AddDate(0, 0, -7)
+	}
+}
+
+// fetchMFAPIData fetches the NAV history of a mutual fund scheme for a chart
+// period. The previous close is the NAV before the latest one
+func fetchMFAPIData(ctx context.Context, schemeCode, period string) (*YahooData, error) {
+	navs, err := fetchMFAPINavs(ctx, schemeCode)
+	if err != nil {
+		return nil, err
+	}
+
+	// Oldest first, within the period
+	start := mfapiStart(period, time.Now())
+	var history []PricePoint
+	for i := len(navs) - 1; i >= 0; i-- {
+		if date, _ := time.Parse("2006-01-02", navs[i].Date); !date.Before(start) {
+			history = append(history, navs[i])
+		}
+	}
+	if len(history) == 0 {
+		history = navs[:1]
+	}
+
+	previousDayClose := navs[0].Price
+	if len(navs) > 1 {
+		previousDayClose = navs[1].Price
+	}
+
+	return &YahooData{
+		CurrentPrice:     navs[0].Price,
+		PreviousDayClose: previousDayClose,
+		History:          history,
+		Interval:         IntervalDaily,
+	}, nil
+}
+
+// fetchMFAPIDaily returns the NAVs of a scheme between two days, oldest first
+func fetchMFAPIDaily(ctx context.Context, schemeCode string, from, to time.Time) ([]PricePoint, error) {
+	navs, err := fetchMFAPINavs(ctx, schemeCode)
+	if err != nil {
+		return nil, err
+	}
+	first, last := from.Format("2006-01-02"), to.Format("2006-01-02")
+	var history []PricePoint
+	for i := len(navs) - 1; i >= 0; i-- {
+		if navs[i].Date >= first && navs[i].Date <= last {
+			history = append(history, navs[i])
+		}
+	}
+	return history, nil
+}
+
+// fetchMFAPINavs fetches the whole NAV history of a scheme, newest first
+func fetchMFAPINavs(ctx context.Context, schemeCode string) ([]PricePoint, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", mfapiURL+schemeCode, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch NAV history: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("mfapi returned status: %s", resp.Status)
+	}
+
+	var mfResp MFAPIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&mfResp); err != nil {
+		return nil, fmt.Errorf("failed to decode json: %v", err)
+	}
+
+	var navs []PricePoint
+	for _, point := range mfResp.Data {
+		date, err := time.Parse("02-01-2006", point.Date)
+		if err != nil {
+			continue
+		}
+		nav, err := strconv.ParseFloat(point.NAV, 64)
+		if err != nil || nav == 0 {
+			continue
+		}
+		// A scheme has one NAV a day, so its candles are flat
+		navs = append(navs, newCandle(date.Format("2006-01-02"), nav, nav, nav, nav, 0))
+	}
+	if len(navs) == 0 {
+		return nil, fmt.Errorf("no NAV history for scheme %s", schemeCode)
+	}
+	return navs, nil
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// defaultCacheTTLs is how long a price history is reused, by chart period.
+// Intraday charts move by the minute, multi-year charts by the week
+var defaultCacheTTLs = map[string]time.Duration{
+	"1D":  30 * time.Second,
+	"1W":  2 * time.Minute,
+	"1M":  10 * time.Minute,
+	"6M":  time.Hour,
+	"YTD": time.Hour,
+	"1Y":  time.Hour,
+	"5Y":  6 * time.Hour,
+}
+
+// PriceCache keeps price histories for a time depending on their chart period,
+// and shares one fetch between concurrent requests for the same history. It is
+// safe for concurrent use. Histories are shared, so callers must not modify them
+type PriceCache struct {
+	mu      sync.Mutex
+	ttls    map[string]time.Duration
+	entries map[string]cachedPrices
+	calls   map[string]*priceCall // fetches in flight
+
+	now func() time.Time // replaced in tests
+}
+
+type cachedPrices struct {
+	data    *YahooData
+	expires time.Time
+}
+
+// priceCall is a fetch in flight; data and err are set once done is closed
+type priceCall struct {
+	done chan struct{}
+	data *YahooData
+	err  error
+}
+
+// NewPriceCache returns a cache with the default TTLs, overridden by ttls
+func NewPriceCache(ttls map[string]time.Duration) *PriceCache {
+	c := &PriceCache{
+		ttls:    make(map[string]time.Duration),
+		entries: make(map[string]cachedPrices),
+		calls:   make(map[string]*priceCall),
+		now:     time.Now,
+	}
+	for period, ttl := range defaultCacheTTLs {
+		c.ttls[period] = ttl
+	}
+	for period, ttl := range ttls {
+		c.ttls[period] = ttl
+	}
+	return c
+}
+
+// Get returns the history cached under key, else the result of fetch. Callers
+// asking for a key already being fetched wait for that fetch instead of starting
+// their own, until ctx is done. Errors are not cached
+func (c *PriceCache) Get(ctx context.Context, key, period string, fetch func() (*YahooData, error)) (*YahooData, error) {
+	c.mu.Lock()
+	if entry, ok := c.entries[key]; ok && c.now().Before(entry.expires) {
+		c.mu.Unlock()
+		return entry.data, nil
+	}
+	call, ok := c.calls[key]
+	if !ok {
+		call = &priceCall{done: make(chan struct{})}
+		c.calls[key] = call
+		// Run apart from this caller, so its going away does not fail the others
+		go c.run(key, period, call, fetch)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.data, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// run completes a fetch, caching its result and dropping expired histories
+func (c *PriceCache) run(key, period string, call *priceCall, fetch func() (*YahooData, error)) {
+	call.data, call.err = fetch()
+
+	c.mu.Lock()
+	now := c.now()
+	for k, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, k)
+		}
+	}
+	if call.err == nil {
+		ttl, ok := c.ttls[period]
+		if !ok {
+			ttl = defaultCacheTTLs["1D"]
+		}
+		c.entries[key] = cachedPrices{data: call.data, expires: now.Add(ttl)}
+	}
+	delete(c.calls, key)
+	c.mu.Unlock()
+
+	close(call.done)
+}
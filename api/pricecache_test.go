@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPriceCache(t *testing.T) {
+	cache := NewPriceCache(map[string]time.Duration{"5Y": 24 * time.Hour})
+	now := time.Date(2025, 6, 2, 9, 15, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	fetch := func() (*YahooData, error) {
+		fetches.Add(1)
+		<-release
+		return &YahooData{CurrentPrice: 2950}, nil
+	}
+
+	// 50 requests at once share one fetch, even if one of them gives up
+	cancelled, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	errs := make(chan error, 51)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data, err := cache.Get(context.Background(), "yahoo|RELIANCE|NSE|1D", "1D", fetch)
+			if err == nil && data.CurrentPrice != 2950 {
+				err = errors.New("wrong price")
+			}
+			errs <- err
+		}()
+	}
+	go func() {
+		_, err := cache.Get(cancelled, "yahoo|RELIANCE|NSE|1D", "1D", fetch)
+		if !errors.Is(err, context.Canceled) {
+			err = errors.New("expected the cancelled request to give up")
+		} else {
+			err = nil
+		}
+		errs <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	for i := 0; i < 51; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Fatalf("Expected one upstream fetch, got %d", n)
+	}
+
+	// 1D histories are kept for seconds
+	cache.Get(context.Background(), "yahoo|RELIANCE|NSE|1D", "1D", fetch)
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("Expected a cached 1D history, got %d fetches", n)
+	}
+	now = now.Add(time.Minute)
+	cache.Get(context.Background(), "yahoo|RELIANCE|NSE|1D", "1D", fetch)
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("Expected the 1D history to expire after a minute, got %d fetches", n)
+	}
+
+	// TTLs can be overridden per period
+	cache.Get(context.Background(), "yahoo|RELIANCE|NSE|5Y", "5Y", fetch)
+	now = now.Add(12 * time.Hour)
+	cache.Get(context.Background(), "yahoo|RELIANCE|NSE|5Y", "5Y", fetch)
+	if n := fetches.Load(); n != 3 {
+		t.Errorf("Expected the 5Y history to be kept for a day, got %d fetches", n)
+	}
+
+	// Errors are not cached
+	failing := func() (*YahooData, error) {
+		fetches.Add(1)
+		return nil, errors.New("yahoo is down")
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := cache.Get(context.Background(), "yahoo|TCS|NSE|1D", "1D", failing); err == nil {
+			t.Fatal("Expected the fetch error")
+		}
+	}
+	if n := fetches.Load(); n != 5 {
+		t.Errorf("Expected failed fetches to be retried, got %d fetches", n)
+	}
+}
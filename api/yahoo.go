@@ -0,0 +1,164 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Yahoo Finance hosts: the home page sets the session cookie, the query host
+// serves crumbs and charts
+const (
+	yahooHomeURL  = "https://finance.yahoo.com"
+	yahooQueryURL = "https://query1.finance.yahoo.com"
+)
+
+const yahooUserAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+
+// YahooSession holds the cookie and crumb Yahoo Finance requires of chart
+// requests. They are fetched on first use and kept until Yahoo rejects them.
+// It is safe for concurrent use; requests waiting for a crumb share one refresh
+type YahooSession struct {
+	homeURL  string
+	queryURL string
+
+	mu     sync.Mutex
+	client *http.Client // keeps the session cookie
+	crumb  string
+}
+
+// NewYahooSession returns a session with Yahoo Finance, or a stand-in for it, at
+// the given home and query base URLs
+func NewYahooSession(homeURL, queryURL string) *YahooSession {
+	return &YahooSession{
+		homeURL:  strings.TrimSuffix(homeURL, "/"),
+		queryURL: strings.TrimSuffix(queryURL, "/"),
+		client:   newYahooClient(),
+	}
+}
+
+// newYahooClient returns a client with an empty cookie jar
+func newYahooClient() *http.Client {
+	jar, _ := cookiejar.New(nil)
+	return &http.Client{Jar: jar, Timeout: 10 * time.Second}
+}
+
+// getCrumb returns the crumb of the session and the client holding its cookie,
+// first fetching the cookie and crumb if there is none
+func (s *YahooSession) getCrumb(ctx context.Context) (string, *http.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.crumb != "" {
+		return s.crumb, s.client, nil
+	}
+
+	// 1. Get Cookie from main page
+	req, err := http.NewRequestWithContext(ctx, "GET", s.homeURL, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	req.Header.Set("User-Agent", yahooUserAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get cookie: %v", err)
+	}
+	resp.Body.Close()
+
+	// 2. Get Crumb
+	req, err = http.NewRequestWithContext(ctx, "GET", s.queryURL+"/v1/test/getcrumb", nil)
+	if err != nil {
+		return "", nil, err
+	}
+	req.Header.Set("User-Agent", yahooUserAgent)
+	req.Header.Set("Origin", s.homeURL)
+	req.Header.Set("Referer", s.homeURL+"/")
+
+	resp, err = s.client.Do(req)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get crumb: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read crumb: %v", err)
+	}
+	crumb := strings.TrimSpace(string(body))
+	if resp.StatusCode != http.StatusOK || crumb == "" || strings.Contains(crumb, "html") {
+		return "", nil, fmt.Errorf("invalid crumb received (status %s)", resp.Status)
+	}
+
+	s.crumb = crumb
+	return crumb, s.client, nil
+}
+
+// invalidate drops a crumb Yahoo rejected along with its session cookie, unless
+// another request has already replaced them. Requests in flight keep the client
+// they started with
+func (s *YahooSession) invalidate(crumb string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.crumb == crumb {
+		s.crumb = ""
+		s.client = newYahooClient()
+	}
+}
+
+// chart fetches the chart of a ticker over span, either range= or period1= and
+// period2= parameters. A request Yahoo rejects for its crumb is retried once
+// with a new cookie and crumb
+func (s *YahooSession) chart(ctx context.Context, ticker, span, interval string) (*YahooChartResponse, error) {
+	// URL encode the ticker to handle special characters like '&' (e.g. M&M.NS) or '^' (e.g. ^NSEI)
+	yahooSymbol := url.QueryEscape(ticker)
+
+	for attempt := 0; ; attempt++ {
+		crumb, client, err := s.getCrumb(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		chartURL := fmt.Sprintf("%s/v8/finance/chart/%s?symbol=%s&%s&interval=%s&crumb=%s",
+			s.queryURL, yahooSymbol, yahooSymbol, span, interval, url.QueryEscape(crumb))
+		req, err := http.NewRequestWithContext(ctx, "GET", chartURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("User-Agent", yahooUserAgent)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch chart: %v", err)
+		}
+		var yahooResp YahooChartResponse
+		decodeErr := json.NewDecoder(resp.Body).Decode(&yahooResp)
+		resp.Body.Close()
+
+		if resp.StatusCode == http.StatusUnauthorized || yahooResp.invalidCrumb() {
+			s.invalidate(crumb)
+			if attempt == 0 {
+				continue
+			}
+			return nil, fmt.Errorf("yahoo rejected the session crumb")
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("yahoo api returned status: %s", resp.Status)
+		}
+		if decodeErr != nil {
+			return nil, fmt.Errorf("failed to decode json: %v", decodeErr)
+		}
+		return &yahooResp, nil
+	}
+}
+
+// invalidCrumb reports whether Yahoo rejected the crumb of a chart request
+func (r *YahooChartResponse) invalidCrumb() bool {
+	return r.Chart.Error != nil && strings.Contains(strings.ToLower(r.Chart.Error.Description), "crumb")
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// yahooStandIn imitates the cookie, crumb and chart endpoints of Yahoo Finance.
+// Each crumb it issues is valid until rotate is called
+type yahooStandIn struct {
+	homeHits, crumbHits atomic.Int32
+	staleCookies        atomic.Int32 // home page requests still carrying a cookie
+	mu                  sync.Mutex
+	crumb               string
+}
+
+func (y *yahooStandIn) rotate() {
+	y.mu.Lock()
+	y.crumb = ""
+	y.mu.Unlock()
+}
+
+func (y *yahooStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	switch r.URL.Path {
+	case "/":
+		y.homeHits.Add(1)
+		if _, err := r.Cookie("A3"); err == nil {
+			y.staleCookies.Add(1)
+		}
+		http.SetCookie(w, &http.Cookie{Name: "A3", Value: "session", Path: "/"})
+	case "/v1/test/getcrumb":
+		if _, err := r.Cookie("A3"); err != nil {
+			http.Error(w, "<html>no cookie</html>", http.StatusForbidden)
+			return
+		}
+		n := y.crumbHits.Add(1)
+		y.crumb = fmt.Sprintf("crumb/%d", n)
+		fmt.Fprint(w, y.crumb)
+	case "/v8/finance/chart/RELIANCE.NS":
+		if y.crumb == "" || r.URL.Query().Get("crumb") != y.crumb {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"chart":{"result":null,"error":{"code":"Unauthorized","description":"Invalid Crumb"}}}`)
+			return
+		}
+		fmt.Fprint(w, `{"chart":{"result":[{
+			"meta":{"regularMarketPrice":1436,"chartPreviousClose":1410,"regularMarketTime":1748937600},
+			"timestamp":[1748835900,1748922300],
+			"indicators":{"quote":[{"open":[1420,1425],"high":[1431,1440],"low":[1415,null],"close":[1425,1436],"volume":[100,200]}]}
+		}],"error":null}}`)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestYahooSession(t *testing.T) {
+	standIn := &yahooStandIn{}
+	server := httptest.NewServer(standIn)
+	defer server.Close()
+	session := NewYahooSession(server.URL, server.URL)
+
+	// Concurrent requests share one cookie and crumb
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := fetchYahooData(context.Background(), session, "RELIANCE.NS", "6M")
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Chart request failed: %v", err)
+		}
+	}
+	if home, crumbs := standIn.homeHits.Load(), standIn.crumbHits.Load(); home != 1 || crumbs != 1 {
+		t.Errorf("Expected one cookie and crumb for all requests, got %d and %d", home, crumbs)
+	}
+
+	data, err := fetchYahooData(context.Background(), session, "RELIANCE.NS", "6M")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.CurrentPrice != 1436 || data.PreviousDayClose != 1410 || len(data.History) != 2 {
+		t.Fatalf("Unexpected chart %+v", data)
+	}
+	if candle := data.History[1]; candle.Open != 1425 || candle.High != 1440 || candle.Low != 1425 || candle.Close != 1436 || candle.Volume != 200 {
+		t.Errorf("Expected the second candle with its missing low taken from the open and close, got %+v", candle)
+	}
+
+	// A rejected crumb is replaced, with a new cookie, and the request retried
+	standIn.rotate()
+	if _, err := fetchYahooData(context.Background(), session, "RELIANCE.NS", "6M"); err != nil {
+		t.Fatalf("Expected the request to succeed with a new crumb, got %v", err)
+	}
+	if crumbs := standIn.crumbHits.Load(); crumbs != 2 {
+		t.Errorf("Expected the crumb to be refreshed once, got %d crumbs", crumbs)
+	}
+	if stale := standIn.staleCookies.Load(); stale != 0 {
+		t.Errorf("Expected the rejected cookie to be dropped, got %d home page requests with it", stale)
+	}
+
+	if _, err := fetchYahooData(context.Background(), session, "UNKNOWN.NS", "6M"); err == nil {
+		t.Error("Expected an error for a ticker without a chart")
+	}
+}
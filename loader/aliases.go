@@ -0,0 +1,83 @@
+package loader
+
+import (
+	"log"
+	"sort"
+	"stock-search/models"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterEnricher("symbol_aliases", func(src Source, stocks []models.Stock) (int, error) {
+		aliases, err := LoadAliases(src.Path)
+		if err != nil {
+			return 0, err
+		}
+		ApplyAliases(stocks, aliases)
+		return len(aliases), nil
+	})
+}
+
+// LoadAliases reads the rename history (ALIAS, SYMBOL, KIND, EFFECTIVE DATE) and
+// returns the former symbols and names of each current symbol, oldest change first
+func LoadAliases(filePath string) (map[string][]models.SymbolAlias, error) {
+	rows, report, err := readCSV(filePath, AliasSchema)
+	if err != nil {
+		return nil, err
+	}
+	for _, issue := range report.Issues {
+		log.Printf("Warning: Symbol aliases: line %d: %s", issue.Line, issue.Message)
+	}
+
+	aliases := make(map[string][]models.SymbolAlias)
+	for _, row := range rows {
+		kind := strings.ToLower(row.Get("KIND"))
+		if kind == "" {
+			kind = models.AliasSymbol
+		}
+		if kind != models.AliasSymbol && kind != models.AliasName {
+			log.Printf("Warning: Symbol aliases: line %d: unknown kind %q", row.Line, kind)
+			continue
+		}
+		effective := row.Get("EFFECTIVE DATE")
+		if _, err := time.Parse("2006-01-02", effective); err != nil {
+			log.Printf("Warning: Symbol aliases: line %d: %q is not a YYYY-MM-DD date", row.Line, effective)
+			continue
+		}
+
+		alias := row.Get("ALIAS")
+		if kind == models.AliasSymbol {
+			alias = strings.ToUpper(alias)
+		}
+		symbol := strings.ToUpper(row.Get("SYMBOL"))
+		aliases[symbol] = append(aliases[symbol], models.SymbolAlias{Alias: alias, Kind: kind, Effective: effective})
+	}
+
+	for _, list := range aliases {
+		sort.SliceStable(list, func(i, j int) bool { return list[i].Effective < list[j].Effective })
+	}
+	return aliases, nil
+}
+
+// ApplyAliases attaches the rename history to the listings trading under each
+// current symbol
+func ApplyAliases(stocks []models.Stock, aliases map[string][]models.SymbolAlias) {
+	for i := range stocks {
+		if list, ok := aliases[strings.ToUpper(stocks[i].Symbol)]; ok {
+			stocks[i].Aliases = list
+		}
+	}
+}
+
+// symbolKeys are the symbols data feeds may use for a stock: its own and its
+// former symbols, so feeds not yet updated after a rename still apply
+func symbolKeys(stock models.Stock) []string {
+	keys := []string{strings.ToUpper(stock.Symbol)}
+	for _, alias := range stock.Aliases {
+		if alias.Kind == models.AliasSymbol {
+			keys = append(keys, alias.Alias)
+		}
+	}
+	return keys
+}
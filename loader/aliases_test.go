@@ -0,0 +1,42 @@
+package loader
+
+import (
+	"stock-search/models"
+	"testing"
+)
+
+func TestLoadAliases(t *testing.T) {
+	path := writeTempFile(t, `ALIAS,SYMBOL,KIND,EFFECTIVE DATE
+ZOMATO,ETERNAL,symbol,2025-04-09
+Zomato Limited,ETERNAL,name,2025-03-20
+tatamotors,TMPV,,2025-10-14
+OLDCO,NEWCO,ticker,2020-01-01
+MISSINGDATE,NEWCO,symbol,soon`)
+
+	aliases, err := LoadAliases(path)
+	if err != nil {
+		t.Fatalf("LoadAliases failed: %v", err)
+	}
+	if len(aliases) != 2 {
+		t.Fatalf("Expected aliases for ETERNAL and TMPV, got %+v", aliases)
+	}
+	eternal := aliases["ETERNAL"]
+	if len(eternal) != 2 || eternal[0].Kind != models.AliasName || eternal[1].Alias != "ZOMATO" {
+		t.Errorf("Expected ETERNAL's aliases oldest first, got %+v", eternal)
+	}
+	if tmpv := aliases["TMPV"]; len(tmpv) != 1 || tmpv[0].Alias != "TATAMOTORS" || tmpv[0].Kind != models.AliasSymbol {
+		t.Errorf("Expected an uppercased symbol alias by default, got %+v", tmpv)
+	}
+
+	// Feeds keyed by a former symbol still apply
+	stocks := []models.Stock{{Symbol: "ETERNAL", Exchange: "NSE"}, {Symbol: "TCS", Exchange: "NSE"}}
+	ApplyAliases(stocks, aliases)
+	ApplyBrandMappings(stocks, map[string]string{"ZOMATO": "Zomato, Blinkit"})
+	if stocks[0].Brand != "Zomato, Blinkit" || len(stocks[0].Aliases) != 2 || stocks[1].Aliases != nil {
+		t.Errorf("Unexpected stocks: %+v", stocks)
+	}
+	ApplyPopularity(stocks, map[string]float64{"ZOMATO": 0.5}, 0)
+	if stocks[0].PopularityScore != 0.5 {
+		t.Errorf("Expected the former symbol's popularity, got %v", stocks[0].PopularityScore)
+	}
+}
@@ -0,0 +1,173 @@
+package loader
+
+import (
+	"bufio"
+	"os"
+	"stock-search/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterLoader("etf_csv", func(src Source) ([]models.Stock, *ValidationReport, error) {
+		return LoadETFsWithReport(src.Path)
+	})
+	RegisterLoader("index_csv", func(src Source) ([]models.Stock, *ValidationReport, error) {
+		return LoadIndicesWithReport(src.Path)
+	})
+	RegisterLoader("amfi_nav", func(src Source) ([]models.Stock, *ValidationReport, error) {
+		return LoadAMFISchemesWithReport(src.Path)
+	})
+}
+
+// LoadETFsWithReport loads the NSE ETF list (Symbol, Underlying, SecurityName,
+// DateofListing, MarketLot, ISINNumber, FaceValue)
+func LoadETFsWithReport(filePath string) ([]models.Stock, *ValidationReport, error) {
+	rows, report, err := readCSV(filePath, ETFSchema)
+	if err != nil {
+		return nil, report, err
+	}
+
+	var stocks []models.Stock
+	for _, row := range rows {
+		stocks = append(stocks, models.Stock{
+			Symbol:      row.Get("SYMBOL"),
+			Name:        row.Get("SECURITY NAME"),
+			Exchange:    "NSE",
+			ISIN:        row.Get("ISIN NUMBER"),
+			Type:        models.TypeETF,
+			Underlying:  row.Get("UNDERLYING"),
+			ListingDate: parseListingDate(row, "DATE OF LISTING", report),
+			MarketLot:   int(parseFloat(row, "MARKET LOT", report)),
+			FaceValue:   parseFloat(row, "FACE VALUE", report),
+		})
+	}
+	report.Loaded = len(stocks)
+
+	return stocks, report, nil
+}
+
+// LoadIndicesWithReport loads market indices (SYMBOL, NAME, EXCHANGE, YAHOO
+// SYMBOL, SECTOR). Indices have no exchange ticker of their own, so they are
+// charted through YAHOO SYMBOL, e.g. ^NSEI for NIFTY 50
+func LoadIndicesWithReport(filePath string) ([]models.Stock, *ValidationReport, error) {
+	rows, report, err := readCSV(filePath, IndexSchema)
+	if err != nil {
+		return nil, report, err
+	}
+
+	var stocks []models.Stock
+	for _, row := range rows {
+		stocks = append(stocks, models.Stock{
+			Symbol:      strings.ToUpper(row.Get("SYMBOL")),
+			Name:        row.Get("NAME"),
+			Exchange:    strings.ToUpper(row.Get("EXCHANGE")),
+			Type:        models.TypeIndex,
+			Sector:      row.Get("SECTOR"),
+			YahooSymbol: row.Get("YAHOO SYMBOL"),
+		})
+	}
+	report.Loaded = len(stocks)
+
+	return stocks, report, nil
+}
+
+// amfiFields are the fields of a scheme line in the AMFI NAV file
+const amfiFields = 6
+
+// LoadAMFISchemesWithReport loads mutual fund schemes from an AMFI NAVAll.txt
+// file. Scheme lines (Scheme Code;ISIN Div Payout/ISIN Growth;ISIN Div
+// Reinvestment;Scheme Name;Net Asset Value;Date) are grouped under a category
+// line such as "Open Ended Schemes(Equity Scheme - Large Cap Fund)" and a fund
+// house line; both apply to the schemes that follow them
+func LoadAMFISchemesWithReport(filePath string) ([]models.Stock, *ValidationReport, error) {
+	report := &ValidationReport{Source: "amfi", File: filePath, Issues: []Issue{}}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, report, err
+	}
+	defer file.Close()
+
+	var stocks []models.Stock
+	var category, fundHouse string
+	seen := make(map[string]int)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		if text == "" {
+			continue
+		}
+		if !strings.Contains(text, ";") {
+			if open := strings.Index(text, "("); open >= 0 && strings.HasSuffix(text, ")") {
+				category = strings.TrimSpace(text[open+1 : len(text)-1])
+			} else {
+				fundHouse = text
+			}
+			continue
+		}
+
+		fields := strings.Split(text, ";")
+		if strings.EqualFold(strings.TrimSpace(fields[0]), "Scheme Code") {
+			continue // header
+		}
+		report.Rows++
+		if len(fields) != amfiFields {
+			report.add(line, SeverityError, IssueMalformedRow, "", "expected %d fields, got %d", amfiFields, len(fields))
+			continue
+		}
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		code, name := fields[0], fields[3]
+		if code == "" || name == "" {
+			report.add(line, SeverityError, IssueMissingField, "Scheme Code", "missing scheme code or name")
+			continue
+		}
+		if first, ok := seen[code]; ok {
+			report.add(line, SeverityError, IssueDuplicate, "Scheme Code", "%s already defined on line %d", code, first)
+			continue
+		}
+		seen[code] = line
+
+		stock := models.Stock{
+			Symbol:         code,
+			Name:           name,
+			Exchange:       models.ExchangeAMFI,
+			ISIN:           amfiISIN(fields[1], fields[2]),
+			Type:           models.TypeMutualFund,
+			FundHouse:      fundHouse,
+			SchemeCategory: category,
+		}
+		// Schemes without a current NAV report "N.A."
+		if nav, err := strconv.ParseFloat(fields[4], 64); err == nil {
+			stock.NAV = nav
+		} else if fields[4] != "N.A." {
+			report.add(line, SeverityWarning, IssueInvalidValue, "Net Asset Value", "%q is not a number", fields[4])
+		}
+		if date, err := time.Parse("02-Jan-2006", fields[5]); err == nil {
+			stock.NAVDate = date.Format("2006-01-02")
+		} else if fields[5] != "" {
+			report.add(line, SeverityWarning, IssueInvalidValue, "Date", "%q is not a DD-MON-YYYY date", fields[5])
+		}
+		stocks = append(stocks, stock)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, report, err
+	}
+	report.Loaded = len(stocks)
+
+	return stocks, report, nil
+}
+
+// amfiISIN returns the payout or growth ISIN of a scheme, else its reinvestment
+// ISIN. AMFI writes "-" for a missing ISIN
+func amfiISIN(payout, reinvestment string) string {
+	for _, isin := range []string{payout, reinvestment} {
+		if len(isin) == 12 {
+			return strings.ToUpper(isin)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,84 @@
+package loader
+
+import (
+	"stock-search/models"
+	"testing"
+)
+
+func TestLoadETFs(t *testing.T) {
+	path := writeTempFile(t, `Symbol,Underlying,SecurityName,DateofListing,MarketLot,ISINNumber,FaceValue
+NIFTYBEES,Nifty 50 Index,Nippon India ETF Nifty 50 BeES,08-JAN-2002,1,INF204KB14I2,1`)
+
+	stocks, report, err := LoadETFsWithReport(path)
+	if err != nil {
+		t.Fatalf("LoadETFsWithReport failed: %v", err)
+	}
+	if len(stocks) != 1 || report.Loaded != 1 {
+		t.Fatalf("Expected 1 ETF, got %+v", stocks)
+	}
+	etf := stocks[0]
+	if etf.Type != models.TypeETF || etf.Exchange != "NSE" || etf.Underlying != "Nifty 50 Index" || etf.ListingDate != "2002-01-08" || etf.ISIN != "INF204KB14I2" {
+		t.Errorf("Unexpected ETF: %+v", etf)
+	}
+	if etf.ChartTicker() != "NIFTYBEES.NS" {
+		t.Errorf("Expected the NSE ticker, got %q", etf.ChartTicker())
+	}
+}
+
+func TestLoadIndices(t *testing.T) {
+	path := writeTempFile(t, `SYMBOL,NAME,EXCHANGE,YAHOO SYMBOL,SECTOR
+nifty,NIFTY 50,nse,^NSEI,
+BANKNIFTY,NIFTY BANK,NSE,^NSEBANK,Banking
+SENSEX,,BSE,^BSESN,`)
+
+	stocks, report, err := LoadIndicesWithReport(path)
+	if err != nil {
+		t.Fatalf("LoadIndicesWithReport failed: %v", err)
+	}
+	if len(stocks) != 2 || report.Errors() != 1 {
+		t.Fatalf("Expected 2 indices and the nameless row rejected, got %+v (%s)", stocks, report)
+	}
+	if stocks[0].Symbol != "NIFTY" || stocks[0].Exchange != "NSE" || stocks[0].Type != models.TypeIndex || stocks[0].ChartTicker() != "^NSEI" {
+		t.Errorf("Unexpected index: %+v", stocks[0])
+	}
+	if stocks[1].Sector != "Banking" {
+		t.Errorf("Expected the sector of a sectoral index, got %q", stocks[1].Sector)
+	}
+}
+
+func TestLoadAMFISchemes(t *testing.T) {
+	path := writeTempFile(t, "Scheme Code;ISIN Div Payout/ ISIN Growth;ISIN Div Reinvestment;Scheme Name;Net Asset Value;Date\r\n"+
+		"\r\nOpen Ended Schemes(Equity Scheme - Large Cap Fund)\r\n\r\nAxis Mutual Fund\r\n\r\n"+
+		"120465;INF846K01DP8;-;Axis Large Cap Fund - Direct Plan - Growth;66.18;14-Oct-2025\r\n"+
+		"120466;-;INF846K01DQ6;Axis Large Cap Fund - Direct Plan - IDCW;N.A.;14-Oct-2025\r\n"+
+		"\r\nOpen Ended Schemes(Other Scheme - Index Funds)\r\n\r\nUTI Mutual Fund\r\n\r\n"+
+		"120716;INF789F01XA0;-;UTI Nifty 50 Index Fund - Growth Option- Direct;176.4129;sometime\r\n"+
+		"120465;INF846K01DP8;-;Axis Large Cap Fund - Direct Plan - Growth;66.18;14-Oct-2025\r\n"+
+		"999999;Broken line\r\n")
+
+	stocks, report, err := LoadAMFISchemesWithReport(path)
+	if err != nil {
+		t.Fatalf("LoadAMFISchemesWithReport failed: %v", err)
+	}
+	if len(stocks) != 3 || report.Rows != 5 {
+		t.Fatalf("Expected 3 schemes from 5 rows, got %+v (%s)", stocks, report)
+	}
+	want := []string{IssueInvalidValue, IssueDuplicate, IssueMalformedRow}
+	got := issueKinds(report)
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("Expected issues %v, got %v", want, got)
+	}
+
+	axis := stocks[0]
+	if axis.Symbol != "120465" || axis.Exchange != models.ExchangeAMFI || axis.Type != models.TypeMutualFund ||
+		axis.FundHouse != "Axis Mutual Fund" || axis.SchemeCategory != "Equity Scheme - Large Cap Fund" ||
+		axis.NAV != 66.18 || axis.NAVDate != "2025-10-14" || axis.ISIN != "INF846K01DP8" {
+		t.Errorf("Unexpected scheme: %+v", axis)
+	}
+	if stocks[1].ISIN != "INF846K01DQ6" || stocks[1].NAV != 0 {
+		t.Errorf("Expected the reinvestment ISIN and no NAV, got %+v", stocks[1])
+	}
+	if stocks[2].FundHouse != "UTI Mutual Fund" || stocks[2].SchemeCategory != "Other Scheme - Index Funds" || stocks[2].NAVDate != "" {
+		t.Errorf("Unexpected scheme: %+v", stocks[2])
+	}
+}
@@ -1,167 +1,70 @@
 package loader
 
 import (
-	"encoding/csv"
 	"encoding/json"
 	"os"
 	"stock-search/models"
-	"strings"
+	"strconv"
+	"time"
 )
 
-// CalculatePopularityScore assigns a popularity score based on well-known stocks
-// Score ranges from 0.1 (unknown) to 1.0 (highly popular)
-func CalculatePopularityScore(symbol string) float64 {
-	symbol = strings.ToUpper(symbol)
-
-	// Tier 1: Most popular stocks (0.9-1.0)
-	tier1 := map[string]float64{
-		"RELIANCE":   1.0,
-		"TCS":        0.98,
-		"HDFCBANK":   0.96,
-		"INFY":       0.95,
-		"ICICIBANK":  0.94,
-		"HINDUNILVR": 0.93,
-		"ITC":        0.92,
-		"SBIN":       0.91,
-		"BHARTIARTL": 0.90,
-		"KOTAKBANK":  0.90,
-	}
-
-	// Tier 2: Well-known large caps (0.7-0.89)
-	tier2 := map[string]float64{
-		"BAJFINANCE": 0.85,
-		"LT":         0.84,
-		"ASIANPAINT": 0.83,
-		"AXISBANK":   0.82,
-		"MARUTI":     0.81,
-		"SUNPHARMA":  0.80,
-		"TITAN":      0.79,
-		"NESTLEIND":  0.78,
-		"ULTRACEMCO": 0.77,
-		"WIPRO":      0.76,
-		"TATAMOTORS": 0.75,
-		"TATAPOWER":  0.74,
-		"TATASTEEL":  0.73,
-		"ADANIPORTS": 0.72,
-		"ADANIENT":   0.71,
-		"ONGC":       0.70,
-	}
-
-	// Tier 3: Mid-caps and sector leaders (0.4-0.69)
-	tier3 := map[string]float64{
-		"DIVISLAB":   0.65,
-		"DRREDDY":    0.64,
-		"CIPLA":      0.63,
-		"TECHM":      0.62,
-		"HCLTECH":    0.61,
-		"POWERGRID":  0.60,
-		"NTPC":       0.59,
-		"COALINDIA":  0.58,
-		"BPCL":       0.57,
-		"IOC":        0.56,
-		"GRASIM":     0.55,
-		"JSWSTEEL":   0.54,
-		"HINDALCO":   0.53,
-		"VEDL":       0.52,
-		"INDUSINDBK": 0.51,
-		"BAJAJFINSV": 0.50,
-		"M&M":        0.49,
-		"EICHERMOT":  0.48,
-		"HEROMOTOCO": 0.47,
-		"BRITANNIA":  0.46,
-		"SHREECEM":   0.45,
-		"UPL":        0.44,
-		"APOLLOHOSP": 0.43,
-		"PIDILITIND": 0.42,
-		"GODREJCP":   0.41,
-		"DABUR":      0.40,
-	}
-
-	if score, ok := tier1[symbol]; ok {
-		return score
-	}
-	if score, ok := tier2[symbol]; ok {
-		return score
-	}
-	if score, ok := tier3[symbol]; ok {
-		return score
-	}
-
-	// Default score for other stocks
-	return 0.2
-}
-
+// LoadStocks loads the curated stock list (Symbol, Name, Exchange, Type, Brand)
 func LoadStocks(filePath string) ([]models.Stock, error) {
-	f, err := os.Open(filePath)
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
+	stocks, _, err := LoadStocksWithReport(filePath)
+	return stocks, err
+}
 
-	reader := csv.NewReader(f)
-	// Read all records
-	records, err := reader.ReadAll()
+// LoadStocksWithReport loads the curated stock list and reports rejected rows
+func LoadStocksWithReport(filePath string) ([]models.Stock, *ValidationReport, error) {
+	rows, report, err := readCSV(filePath, CuratedSchema)
 	if err != nil {
-		return nil, err
+		return nil, report, err
 	}
 
 	var stocks []models.Stock
-	// Skip header row if present (assuming first row is header)
-	if len(records) > 0 {
-		// Simple check: if the first cell is "Symbol", skip it
-		if records[0][0] == "Symbol" {
-			records = records[1:]
-		}
-	}
-
-	for _, record := range records {
-		if len(record) < 4 {
-			continue
-		}
+	for _, row := range rows {
 		stock := models.Stock{
-			Symbol:          record[0],
-			Name:            record[1],
-			Exchange:        record[2],
-			Type:            record[3],
-			Brand:           record[4],
-			PopularityScore: CalculatePopularityScore(record[0]),
+			Symbol:   row.Get("Symbol"),
+			Name:     row.Get("Name"),
+			Exchange: row.Get("Exchange"),
+			Type:     row.Get("Type"),
+			Brand:    row.Get("Brand"),
 		}
 		stocks = append(stocks, stock)
 	}
+	report.Loaded = len(stocks)
 
-	return stocks, nil
+	return stocks, report, nil
 }
 
+// LoadNSEStocks loads the NSE equity list with its master data columns
 func LoadNSEStocks(filePath string) ([]models.Stock, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
+	stocks, _, err := LoadNSEStocksWithReport(filePath)
+	return stocks, err
+}
 
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
+// LoadNSEStocksWithReport loads the NSE equity list and reports rejected rows and unparseable values
+func LoadNSEStocksWithReport(filePath string) ([]models.Stock, *ValidationReport, error) {
+	rows, report, err := readCSV(filePath, NSESchema)
 	if err != nil {
-		return nil, err
+		return nil, report, err
 	}
 
 	var stocks []models.Stock
-	// Skip header row
-	for i, record := range records {
-		if i == 0 {
-			continue
-		}
-		// NSE CSV Format: SYMBOL,NAME OF COMPANY, SERIES, DATE OF LISTING, PAID UP VALUE, MARKET LOT, ISIN NUMBER, FACE VALUE
-		// We only want EQ series for now, or maybe all? Let's filter for EQ/BE to be safe, or just take all.
-		// Let's take all for now.
-
+	for _, row := range rows {
+		// All series are kept; search can filter on series instead
 		stock := models.Stock{
-			Symbol:          record[0],
-			Name:            record[1],
-			Exchange:        "NSE",
-			Type:            "Stock", // Defaulting to Stock
-			Brand:           "",      // No brand data in this file
-			PopularityScore: CalculatePopularityScore(record[0]),
+			Symbol:      row.Get("SYMBOL"),
+			Name:        row.Get("NAME OF COMPANY"),
+			Exchange:    "NSE",
+			ISIN:        row.Get("ISIN NUMBER"),
+			Type:        "Stock", // Defaulting to Stock
+			Brand:       "",      // No brand data in this file
+			Series:      row.Get("SERIES"),
+			ListingDate: parseListingDate(row, "DATE OF LISTING", report),
+			PaidUpValue: parseFloat(row, "PAID UP VALUE", report),
+			MarketLot:   int(parseFloat(row, "MARKET LOT", report)),
+			FaceValue:   parseFloat(row, "FACE VALUE", report),
 		}
 		stocks = append(stocks, stock)
 	}
@@ -169,40 +72,61 @@ func LoadNSEStocks(filePath string) ([]models.Stock, error) {
 	// Apply automatic classification
 	classifier := NewStockClassifier()
 	stocks = classifier.ClassifyBatch(stocks)
+	report.Loaded = len(stocks)
 
-	return stocks, nil
+	return stocks, report, nil
 }
 
-func LoadBSEStocks(filePath string) ([]models.Stock, error) {
-	file, err := os.Open(filePath)
+// parseListingDate converts an NSE listing date such as 06-OCT-2008 to
+// YYYY-MM-DD, reporting values that cannot be parsed
+func parseListingDate(row Row, column string, report *ValidationReport) string {
+	value := row.Get(column)
+	if value == "" {
+		return ""
+	}
+	date, err := time.Parse("02-Jan-2006", value)
 	if err != nil {
-		return nil, err
+		report.add(row.Line, SeverityWarning, IssueInvalidValue, column, "%q is not a DD-MON-YYYY date", value)
+		return ""
 	}
-	defer file.Close()
+	return date.Format("2006-01-02")
+}
 
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
+// parseFloat parses a numeric column, reporting malformed values and treating them as 0
+func parseFloat(row Row, column string, report *ValidationReport) float64 {
+	value := row.Get(column)
+	if value == "" {
+		return 0
+	}
+	f, err := strconv.ParseFloat(value, 64)
 	if err != nil {
-		return nil, err
+		report.add(row.Line, SeverityWarning, IssueInvalidValue, column, "%q is not a number", value)
+		return 0
 	}
+	return f
+}
 
-	var stocks []models.Stock
-	// Skip header row
-	for i, record := range records {
-		if i == 0 {
-			continue
-		}
-		// BSE CSV Format: SYMBOL (Scrip Code),NAME OF COMPANY
-		// We only want EQ series for now, or maybe all? Let's filter for EQ/BE to be safe, or just take all.
-		// Let's take all for now.
+// LoadBSEStocks loads the BSE equity list, keyed by scrip code
+func LoadBSEStocks(filePath string) ([]models.Stock, error) {
+	stocks, _, err := LoadBSEStocksWithReport(filePath)
+	return stocks, err
+}
 
+// LoadBSEStocksWithReport loads the BSE equity list and reports rejected rows
+func LoadBSEStocksWithReport(filePath string) ([]models.Stock, *ValidationReport, error) {
+	rows, report, err := readCSV(filePath, BSESchema)
+	if err != nil {
+		return nil, report, err
+	}
+
+	var stocks []models.Stock
+	for _, row := range rows {
 		stock := models.Stock{
-			Symbol:          record[0],
-			Name:            record[1],
-			Exchange:        "BSE",
-			Type:            "Stock", // Defaulting to Stock
-			Brand:           "",      // No brand data in this file
-			PopularityScore: CalculatePopularityScore(record[0]),
+			Symbol:   row.Get("SYMBOL"),
+			Name:     row.Get("NAME OF COMPANY"),
+			Exchange: "BSE",
+			Type:     "Stock", // Defaulting to Stock
+			Brand:    "",      // No brand data in this file
 		}
 		stocks = append(stocks, stock)
 	}
@@ -210,8 +134,9 @@ func LoadBSEStocks(filePath string) ([]models.Stock, error) {
 	// Apply automatic classification
 	classifier := NewStockClassifier()
 	stocks = classifier.ClassifyBatch(stocks)
+	report.Loaded = len(stocks)
 
-	return stocks, nil
+	return stocks, report, nil
 }
 
 func LoadBrandMappings(filePath string) (map[string]string, error) {
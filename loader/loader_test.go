@@ -1,7 +1,6 @@
 package loader
 
 import (
-	"encoding/json"
 	"os"
 	"testing"
 )
@@ -75,3 +74,40 @@ func TestLoadBrandMappings(t *testing.T) {
 		t.Errorf("Incorrect mapping for RELIANCE")
 	}
 }
+
+func TestLoadNSEStocks(t *testing.T) {
+	content := `SYMBOL,NAME OF COMPANY, SERIES, DATE OF LISTING, PAID UP VALUE, MARKET LOT, ISIN NUMBER, FACE VALUE
+RELIANCE,Reliance Industries Limited,EQ,29-NOV-1995,10,1,INE002A01018,10
+RHFL,Reliance Home Finance Limited,BZ,22-SEP-2017,10,1,INE217K01011,10`
+	tmpfile, err := os.CreateTemp("", "nse_*.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+
+	if _, err := tmpfile.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tmpfile.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	stocks, err := LoadNSEStocks(tmpfile.Name())
+	if err != nil {
+		t.Fatalf("LoadNSEStocks failed: %v", err)
+	}
+	if len(stocks) != 2 {
+		t.Fatalf("Expected 2 stocks, got %d", len(stocks))
+	}
+
+	stock := stocks[0]
+	if stock.ISIN != "INE002A01018" || stock.Series != "EQ" || stock.ListingDate != "1995-11-29" {
+		t.Errorf("Unexpected master data: %+v", stock)
+	}
+	if stock.PaidUpValue != 10 || stock.MarketLot != 1 || stock.FaceValue != 10 {
+		t.Errorf("Unexpected numeric columns: %+v", stock)
+	}
+	if stocks[1].Series != "BZ" {
+		t.Errorf("Expected series BZ, got %q", stocks[1].Series)
+	}
+}
@@ -0,0 +1,232 @@
+package loader
+
+import (
+	"fmt"
+	"reflect"
+	"stock-search/models"
+	"strings"
+)
+
+// Merge strategies
+const (
+	// MergeFirst takes the value of the highest priority source that has one
+	MergeFirst = "first"
+	// MergeConcat combines the comma-separated values of every source, in
+	// priority order and without repeats. Only valid for text fields
+	MergeConcat = "concat"
+)
+
+// ProvenanceLinked marks an ISIN copied from the NSE listing of the same company
+const ProvenanceLinked = "linked"
+
+// MergePolicy decides how records of the same listing from several sources are
+// combined, field by field. Fields without a policy take the value of the
+// highest precedence source that has one
+type MergePolicy struct {
+	Fields map[string]FieldPolicy `json:"fields"` // keyed by JSON field name, e.g. "name", "brand"
+}
+
+// FieldPolicy is the merge rule of one field
+type FieldPolicy struct {
+	Precedence []string `json:"precedence,omitempty"` // sources tried first, in order; the rest follow by precedence
+	Strategy   string   `json:"strategy,omitempty"`   // MergeFirst (default) or MergeConcat
+}
+
+// SourceStocks are the listings read from one source
+type SourceStocks struct {
+	Source Source
+	Stocks []models.Stock
+}
+
+// mergeField is a field of models.Stock taking part in merges
+type mergeField struct {
+	name  string // JSON name
+	index int
+	text  bool
+}
+
+// mergeFields are the fields of models.Stock that are merged: all but the
+// listing key, the provenance itself and the lookup-only RenamedFrom
+var mergeFields = func() []mergeField {
+	var fields []mergeField
+	t := reflect.TypeOf(models.Stock{})
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		switch name {
+		case "", "-", "symbol", "exchange", "provenance", "renamedFrom":
+			continue
+		}
+		fields = append(fields, mergeField{name: name, index: i, text: t.Field(i).Type.Kind() == reflect.String})
+	}
+	return fields
+}()
+
+func findMergeField(name string) (mergeField, bool) {
+	for _, field := range mergeFields {
+		if field.name == name {
+			return field, true
+		}
+	}
+	return mergeField{}, false
+}
+
+// validate checks the policy against the configured source names
+func (p MergePolicy) validate(sources map[string]bool) error {
+	for name, policy := range p.Fields {
+		field, ok := findMergeField(name)
+		if !ok {
+			return fmt.Errorf("merge: unknown field %q", name)
+		}
+		switch policy.Strategy {
+		case "", MergeFirst:
+		case MergeConcat:
+			if !field.text {
+				return fmt.Errorf("merge: field %q: %s needs a text field", name, MergeConcat)
+			}
+		default:
+			return fmt.Errorf("merge: field %q: unknown strategy %q", name, policy.Strategy)
+		}
+		for _, source := range policy.Precedence {
+			if !sources[source] {
+				return fmt.Errorf("merge: field %q: unknown source %q", name, source)
+			}
+		}
+	}
+	return nil
+}
+
+// mergeRecord is one source's record of a listing
+type mergeRecord struct {
+	source string
+	stock  models.Stock
+}
+
+// Merge combines the listings of several sources, given in ascending precedence
+// order, into one record per symbol and exchange. Listings keep the order in
+// which they first appear, and each merged field records the source it came
+// from in Provenance
+func (p MergePolicy) Merge(loaded []SourceStocks) []models.Stock {
+	// Default priority: highest precedence first
+	var byPrecedence []string
+	for i := len(loaded) - 1; i >= 0; i-- {
+		byPrecedence = append(byPrecedence, loaded[i].Source.Name)
+	}
+
+	var keys []string
+	groups := make(map[string][]mergeRecord)
+	for _, set := range loaded {
+		for _, stock := range set.Stocks {
+			key := stock.Symbol + "-" + stock.Exchange
+			if _, ok := groups[key]; !ok {
+				keys = append(keys, key)
+			}
+			groups[key] = append(groups[key], mergeRecord{source: set.Source.Name, stock: stock})
+		}
+	}
+
+	merged := make([]models.Stock, 0, len(keys))
+	for _, key := range keys {
+		merged = append(merged, p.mergeRecords(groups[key], byPrecedence))
+	}
+	return merged
+}
+
+func (p MergePolicy) mergeRecords(records []mergeRecord, byPrecedence []string) models.Stock {
+	stock := models.Stock{
+		Symbol:     records[0].stock.Symbol,
+		Exchange:   records[0].stock.Exchange,
+		Provenance: make(map[string]string),
+	}
+	out := reflect.ValueOf(&stock).Elem()
+
+	for _, field := range mergeFields {
+		policy := p.Fields[field.name]
+		ordered := orderRecords(records, policy.Precedence, byPrecedence)
+
+		if policy.Strategy == MergeConcat {
+			var values, sources []string
+			seen := make(map[string]bool)
+			for _, record := range ordered {
+				contributed := false
+				for _, value := range strings.Split(reflect.ValueOf(record.stock).Field(field.index).String(), ",") {
+					value = strings.TrimSpace(value)
+					if value == "" || seen[strings.ToLower(value)] {
+						continue
+					}
+					seen[strings.ToLower(value)] = true
+					values = append(values, value)
+					contributed = true
+				}
+				if contributed {
+					sources = append(sources, record.source)
+				}
+			}
+			if len(values) > 0 {
+				out.Field(field.index).SetString(strings.Join(values, ", "))
+				stock.Provenance[field.name] = strings.Join(sources, "+")
+			}
+			continue
+		}
+
+		for _, record := range ordered {
+			value := reflect.ValueOf(record.stock).Field(field.index)
+			if !value.IsZero() {
+				out.Field(field.index).Set(value)
+				stock.Provenance[field.name] = record.source
+				break
+			}
+		}
+	}
+	return stock
+}
+
+// orderRecords sorts records by the sources named in precedence, then by
+// byPrecedence. Records of the same source keep their order
+func orderRecords(records []mergeRecord, precedence, byPrecedence []string) []mergeRecord {
+	rank := make(map[string]int)
+	for _, source := range append(append([]string{}, precedence...), byPrecedence...) {
+		if _, ok := rank[source]; !ok {
+			rank[source] = len(rank)
+		}
+	}
+
+	ordered := make([]mergeRecord, 0, len(records))
+	for r := 0; r < len(rank); r++ {
+		for _, record := range records {
+			if rank[record.source] == r {
+				ordered = append(ordered, record)
+			}
+		}
+	}
+	return ordered
+}
+
+// recordProvenance notes the fields an enrichment changed. A field that already
+// had a value keeps its previous source as well
+func recordProvenance(before, after *models.Stock, source string) {
+	b := reflect.ValueOf(*before)
+	a := reflect.ValueOf(*after)
+	for _, field := range mergeFields {
+		if reflect.DeepEqual(b.Field(field.index).Interface(), a.Field(field.index).Interface()) {
+			continue
+		}
+		previous := ""
+		if !b.Field(field.index).IsZero() {
+			previous = before.Provenance[field.name]
+		}
+		setProvenance(after, field.name, source, previous)
+	}
+}
+
+// setProvenance records source as the origin of a field, after previous if set
+func setProvenance(stock *models.Stock, field, source, previous string) {
+	provenance := make(map[string]string, len(stock.Provenance)+1)
+	for k, v := range stock.Provenance {
+		provenance[k] = v
+	}
+	if previous != "" {
+		source = previous + "+" + source
+	}
+	provenance[field] = source
+	stock.Provenance = provenance
+}
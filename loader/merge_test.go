@@ -0,0 +1,78 @@
+package loader
+
+import (
+	"stock-search/models"
+	"testing"
+)
+
+func TestMergePolicy(t *testing.T) {
+	loaded := []SourceStocks{
+		{Source: Source{Name: "nse_equity", Precedence: 10}, Stocks: []models.Stock{
+			{Symbol: "RELIANCE", Exchange: "NSE", Name: "Reliance Industries Limited", Type: "Stock", ISIN: "INE002A01018", Series: "EQ"},
+			{Symbol: "TCS", Exchange: "NSE", Name: "Tata Consultancy Services Limited", Type: "Stock"},
+		}},
+		{Source: Source{Name: "curated", Precedence: 100}, Stocks: []models.Stock{
+			{Symbol: "RELIANCE", Exchange: "NSE", Name: "Reliance", Type: "Conglomerate", Brand: "Jio, Reliance Retail"},
+			{Symbol: "RELIANCE", Exchange: "BSE", Name: "Reliance", Brand: "Jio"},
+		}},
+	}
+	policy := MergePolicy{Fields: map[string]FieldPolicy{
+		"name":  {Precedence: []string{"nse_equity"}},
+		"brand": {Strategy: MergeConcat},
+	}}
+
+	merged := policy.Merge(loaded)
+	if len(merged) != 3 {
+		t.Fatalf("Expected 3 listings, got %+v", merged)
+	}
+	if merged[0].Symbol != "RELIANCE" || merged[1].Symbol != "TCS" || merged[2].Exchange != "BSE" {
+		t.Errorf("Expected listings in order of first appearance, got %+v", merged)
+	}
+
+	reliance := merged[0]
+	if reliance.Name != "Reliance Industries Limited" || reliance.Provenance["name"] != "nse_equity" {
+		t.Errorf("Expected the NSE name, got %q from %q", reliance.Name, reliance.Provenance["name"])
+	}
+	if reliance.Type != "Conglomerate" || reliance.Provenance["type"] != "curated" {
+		t.Errorf("Expected the curated type by precedence, got %q from %q", reliance.Type, reliance.Provenance["type"])
+	}
+	if reliance.ISIN != "INE002A01018" || reliance.Series != "EQ" || reliance.Provenance["isin"] != "nse_equity" {
+		t.Errorf("Expected bulk fields to survive the merge, got %+v", reliance)
+	}
+
+	// Enrichments are recorded after the source of the existing value
+	stocks := []models.Stock{reliance}
+	registerTestEnricher(t, "test_brands", func(src Source, stocks []models.Stock) (int, error) {
+		ApplyBrandMappings(stocks, map[string]string{"RELIANCE": "JioMart"})
+		return 1, nil
+	})
+	if _, err := Enrich(Source{Name: "brands", Loader: "test_brands"}, stocks); err != nil {
+		t.Fatalf("Enrich failed: %v", err)
+	}
+	if stocks[0].Brand != "Jio, Reliance Retail, JioMart" || stocks[0].Provenance["brand"] != "curated+brands" {
+		t.Errorf("Unexpected brand %q from %q", stocks[0].Brand, stocks[0].Provenance["brand"])
+	}
+	if reliance.Provenance["brand"] != "curated" {
+		t.Errorf("Expected the merged record's provenance to be left alone, got %q", reliance.Provenance["brand"])
+	}
+}
+
+func TestMergeConcat(t *testing.T) {
+	loaded := []SourceStocks{
+		{Source: Source{Name: "a"}, Stocks: []models.Stock{{Symbol: "ITC", Exchange: "NSE", Brand: "Aashirvaad, Sunfeast"}}},
+		{Source: Source{Name: "b"}, Stocks: []models.Stock{{Symbol: "ITC", Exchange: "NSE", Brand: "sunfeast, Bingo!"}}},
+	}
+	policy := MergePolicy{Fields: map[string]FieldPolicy{"brand": {Strategy: MergeConcat, Precedence: []string{"a"}}}}
+
+	merged := policy.Merge(loaded)
+	if merged[0].Brand != "Aashirvaad, Sunfeast, Bingo!" || merged[0].Provenance["brand"] != "a+b" {
+		t.Errorf("Unexpected brand %q from %q", merged[0].Brand, merged[0].Provenance["brand"])
+	}
+
+	if err := (MergePolicy{Fields: map[string]FieldPolicy{"market_lot": {Strategy: MergeConcat}}}).validate(nil); err == nil {
+		t.Error("Expected concat on a numeric field to be rejected")
+	}
+	if err := (MergePolicy{Fields: map[string]FieldPolicy{"name": {Precedence: []string{"lse"}}}}).validate(map[string]bool{"a": true}); err == nil {
+		t.Error("Expected an unknown source to be rejected")
+	}
+}
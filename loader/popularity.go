@@ -0,0 +1,238 @@
+package loader
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"stock-search/models"
+	"strconv"
+	"strings"
+)
+
+// Scales mapping a numeric popularity signal to 0-1, relative to the other stocks
+const (
+	ScaleLinear = "linear" // value / max
+	ScaleLog    = "log"    // log(1+value) / log(1+max), for values spanning orders of magnitude
+	ScaleRank   = "rank"   // percentile rank, ignoring how far apart the values are
+)
+
+// PopularitySignal is one input of the popularity formula: a column of a CSV file
+// keyed by NSE symbol (SYMBOL)
+type PopularitySignal struct {
+	Path   string  `json:"path"`
+	Column string  `json:"column"`
+	Weight float64 `json:"weight"`
+	Scale  string  `json:"scale,omitempty"` // for numeric columns, ScaleLinear by default
+
+	// Categories scores a text column instead, e.g. index names; a symbol listed
+	// in several categories takes the highest score
+	Categories map[string]float64 `json:"categories,omitempty"`
+}
+
+// PopularityConfig is the popularity formula. A stock scores
+//
+//	floor + (1 - floor) * sum(weight * signal) / sum(weight)
+//
+// where each signal is 0-1 and 0 for stocks missing from its file
+type PopularityConfig struct {
+	Floor   float64                     `json:"floor"`
+	Signals map[string]PopularitySignal `json:"signals"`
+}
+
+func init() {
+	RegisterEnricher("popularity", func(src Source, stocks []models.Stock) (int, error) {
+		config, err := LoadPopularityConfig(src.Path)
+		if err != nil {
+			return 0, err
+		}
+		scores, err := config.Scores()
+		if err != nil {
+			return 0, err
+		}
+		ApplyPopularity(stocks, scores, config.Floor)
+		return len(scores), nil
+	})
+	RegisterInputs("popularity", func(src Source) []string {
+		config, err := LoadPopularityConfig(src.Path)
+		if err != nil {
+			return nil
+		}
+		var paths []string
+		for _, signal := range config.Signals {
+			paths = append(paths, signal.Path)
+		}
+		sort.Strings(paths)
+		return paths
+	})
+}
+
+// LoadPopularityConfig reads and validates a popularity formula
+func LoadPopularityConfig(filePath string) (*PopularityConfig, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var config PopularityConfig
+	if err := json.NewDecoder(file).Decode(&config); err != nil {
+		return nil, err
+	}
+
+	if config.Floor < 0 || config.Floor > 1 {
+		return nil, fmt.Errorf("floor must be between 0 and 1")
+	}
+	for name, signal := range config.Signals {
+		if signal.Path == "" || signal.Column == "" {
+			return nil, fmt.Errorf("signal %q: path and column are required", name)
+		}
+		if signal.Weight < 0 {
+			return nil, fmt.Errorf("signal %q: weight must not be negative", name)
+		}
+		switch signal.Scale {
+		case "", ScaleLinear, ScaleLog, ScaleRank:
+		default:
+			return nil, fmt.Errorf("signal %q: unknown scale %q", name, signal.Scale)
+		}
+	}
+	return &config, nil
+}
+
+// Scores computes the weighted popularity of every symbol found in a signal
+// file, before the floor is applied. Symbols are uppercased
+func (c *PopularityConfig) Scores() (map[string]float64, error) {
+	var totalWeight float64
+	for _, signal := range c.Signals {
+		totalWeight += signal.Weight
+	}
+	if totalWeight == 0 {
+		return nil, fmt.Errorf("signal weights add up to 0")
+	}
+
+	// Signals are read in name order so warnings come out deterministically
+	names := make([]string, 0, len(c.Signals))
+	for name := range c.Signals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	scores := make(map[string]float64)
+	for _, name := range names {
+		signal := c.Signals[name]
+		values, err := signal.read(name)
+		if err != nil {
+			return nil, fmt.Errorf("signal %q: %v", name, err)
+		}
+		for symbol, value := range values {
+			scores[symbol] += signal.Weight * value / totalWeight
+		}
+	}
+	return scores, nil
+}
+
+// read returns the 0-1 value of the signal per symbol
+func (s PopularitySignal) read(name string) (map[string]float64, error) {
+	rows, report, err := readCSV(s.Path, Schema{
+		Source:  name,
+		Columns: []Column{{Name: "SYMBOL", Required: true}, {Name: s.Column, Required: true}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, issue := range report.Issues {
+		log.Printf("Warning: Popularity signal %s: line %d: %s", name, issue.Line, issue.Message)
+	}
+
+	values := make(map[string]float64)
+	if s.Categories != nil {
+		for _, row := range rows {
+			score, ok := s.Categories[row.Get(s.Column)]
+			symbol := strings.ToUpper(row.Get("SYMBOL"))
+			if ok && score > values[symbol] {
+				values[symbol] = score
+			}
+		}
+		return values, nil
+	}
+
+	for _, row := range rows {
+		value, err := strconv.ParseFloat(strings.ReplaceAll(row.Get(s.Column), ",", ""), 64)
+		if err != nil || value < 0 {
+			log.Printf("Warning: Popularity signal %s: line %d: %q is not a positive number", name, row.Line, row.Get(s.Column))
+			continue
+		}
+		values[strings.ToUpper(row.Get("SYMBOL"))] = value
+	}
+	return scale(values, s.Scale), nil
+}
+
+// scale maps raw values to 0-1
+func scale(values map[string]float64, method string) map[string]float64 {
+	scaled := make(map[string]float64, len(values))
+	if method == ScaleRank {
+		sorted := make([]float64, 0, len(values))
+		for _, value := range values {
+			sorted = append(sorted, value)
+		}
+		sort.Float64s(sorted)
+		for symbol, value := range values {
+			if len(sorted) == 1 {
+				scaled[symbol] = 1
+				continue
+			}
+			below := sort.SearchFloat64s(sorted, value) // ties share the lowest rank
+			scaled[symbol] = float64(below) / float64(len(sorted)-1)
+		}
+		return scaled
+	}
+
+	var max float64
+	for _, value := range values {
+		max = math.Max(max, value)
+	}
+	for symbol, value := range values {
+		switch {
+		case max == 0:
+			scaled[symbol] = 0
+		case method == ScaleLog:
+			scaled[symbol] = math.Log1p(value) / math.Log1p(max)
+		default:
+			scaled[symbol] = value / max
+		}
+	}
+	return scaled
+}
+
+// ApplyPopularity sets the popularity of every stock from scores keyed by NSE
+// symbol, or by a former symbol. Listings without a score of their own, such as
+// BSE scrip codes, take the score of a listing with the same ISIN; the rest get
+// the floor
+func ApplyPopularity(stocks []models.Stock, scores map[string]float64, floor float64) {
+	scoreOf := func(stock models.Stock) (float64, bool) {
+		best, found := 0.0, false
+		for _, key := range symbolKeys(stock) {
+			if score, ok := scores[key]; ok {
+				best, found = math.Max(best, score), true
+			}
+		}
+		return best, found
+	}
+
+	byISIN := make(map[string]float64)
+	for _, stock := range stocks {
+		if score, ok := scoreOf(stock); ok && stock.ISIN != "" {
+			byISIN[stock.ISIN] = math.Max(byISIN[stock.ISIN], score)
+		}
+	}
+
+	for i := range stocks {
+		score, ok := scoreOf(stocks[i])
+		if !ok && stocks[i].ISIN != "" {
+			score = byISIN[stocks[i].ISIN]
+		}
+		stocks[i].PopularityScore = floor + (1-floor)*score
+	}
+}
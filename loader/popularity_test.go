@@ -0,0 +1,78 @@
+package loader
+
+import (
+	"math"
+	"stock-search/models"
+	"testing"
+)
+
+func TestPopularityScores(t *testing.T) {
+	marketData := writeTempFile(t, `SYMBOL,MARKET CAP
+RELIANCE,1900000
+INFY,630000
+SUZLON,not known`)
+	indices := writeTempFile(t, `SYMBOL,INDEX
+RELIANCE,NIFTY 50
+INFY,NIFTY 50
+INFY,NIFTY IT
+TATAPOWER,NIFTY NEXT 50`)
+	configPath := writeTempFile(t, `{
+		"floor": 0.2,
+		"signals": {
+			"market_cap": {"path": "`+marketData+`", "column": "MARKET CAP", "scale": "linear", "weight": 3},
+			"index": {"path": "`+indices+`", "column": "INDEX", "categories": {"NIFTY 50": 1, "NIFTY NEXT 50": 0.5}, "weight": 1}
+		}
+	}`)
+
+	config, err := LoadPopularityConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadPopularityConfig failed: %v", err)
+	}
+	scores, err := config.Scores()
+	if err != nil {
+		t.Fatalf("Scores failed: %v", err)
+	}
+
+	want := map[string]float64{
+		"RELIANCE":  1,
+		"INFY":      0.75*630000/1900000 + 0.25,
+		"TATAPOWER": 0.25 * 0.5,
+	}
+	if len(scores) != len(want) {
+		t.Errorf("Expected scores for %v, got %v", want, scores)
+	}
+	for symbol, score := range want {
+		if math.Abs(scores[symbol]-score) > 1e-9 {
+			t.Errorf("Expected %s to score %.4f, got %.4f", symbol, score, scores[symbol])
+		}
+	}
+
+	stocks := []models.Stock{
+		{Symbol: "RELIANCE", Exchange: "NSE", ISIN: "INE002A01018"},
+		{Symbol: "500325", Exchange: "BSE", ISIN: "INE002A01018"},
+		{Symbol: "20MICRONS", Exchange: "NSE"},
+	}
+	ApplyPopularity(stocks, scores, config.Floor)
+	if stocks[0].PopularityScore != 1 || stocks[1].PopularityScore != 1 {
+		t.Errorf("Expected both RELIANCE listings to score 1, got %+v", stocks)
+	}
+	if stocks[2].PopularityScore != 0.2 {
+		t.Errorf("Expected a stock without signals to get the floor, got %v", stocks[2].PopularityScore)
+	}
+}
+
+func TestPopularityScale(t *testing.T) {
+	values := map[string]float64{"A": 0, "B": 10, "C": 10, "D": 1000}
+
+	rank := scale(values, ScaleRank)
+	if rank["A"] != 0 || rank["B"] != rank["C"] || rank["D"] != 1 {
+		t.Errorf("Unexpected ranks: %v", rank)
+	}
+	logScaled := scale(values, ScaleLog)
+	if logScaled["D"] != 1 || logScaled["B"] < 0.3 || logScaled["B"] > 0.4 {
+		t.Errorf("Unexpected log scale: %v", logScaled)
+	}
+	if linear := scale(values, ScaleLinear); linear["B"] != 0.01 {
+		t.Errorf("Unexpected linear scale: %v", linear)
+	}
+}
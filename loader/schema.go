@@ -0,0 +1,291 @@
+package loader
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Column declares one column of a CSV source. Columns are found by header name,
+// compared case-insensitively, so their order in the file does not matter
+type Column struct {
+	Name     string
+	Aliases  []string // alternative header names
+	Required bool     // rows with an empty value are rejected
+}
+
+// Schema declares the columns of a CSV source
+type Schema struct {
+	Source  string
+	Columns []Column
+	Key     []string // columns identifying a row; rows repeating a key are rejected
+}
+
+// Schemas of the bundled data sources
+var (
+	CuratedSchema = Schema{
+		Source: "curated",
+		Columns: []Column{
+			{Name: "Symbol", Required: true},
+			{Name: "Name", Required: true},
+			{Name: "Exchange", Required: true},
+			{Name: "Type"},
+			{Name: "Brand"},
+		},
+		Key: []string{"Symbol", "Exchange"},
+	}
+
+	NSESchema = Schema{
+		Source: "nse",
+		Columns: []Column{
+			{Name: "SYMBOL", Required: true},
+			{Name: "NAME OF COMPANY", Required: true},
+			{Name: "SERIES"},
+			{Name: "DATE OF LISTING"},
+			{Name: "PAID UP VALUE"},
+			{Name: "MARKET LOT"},
+			{Name: "ISIN NUMBER", Aliases: []string{"ISIN"}},
+			{Name: "FACE VALUE"},
+		},
+		Key: []string{"SYMBOL"},
+	}
+
+	BSESchema = Schema{
+		Source: "bse",
+		Columns: []Column{
+			{Name: "SYMBOL", Aliases: []string{"SCRIP CODE", "SECURITY CODE"}, Required: true},
+			{Name: "NAME OF COMPANY", Aliases: []string{"SECURITY NAME", "ISSUER NAME"}, Required: true},
+		},
+		Key: []string{"SYMBOL"},
+	}
+
+	StatusSchema = Schema{
+		Source: "status",
+		Columns: []Column{
+			{Name: "SYMBOL", Required: true},
+			{Name: "EXCHANGE"},
+			{Name: "STATUS", Required: true},
+			{Name: "SINCE"},
+			{Name: "REASON"},
+		},
+		Key: []string{"SYMBOL", "EXCHANGE"},
+	}
+
+	ETFSchema = Schema{
+		Source: "etf",
+		Columns: []Column{
+			{Name: "SYMBOL", Required: true},
+			{Name: "UNDERLYING"},
+			{Name: "SECURITY NAME", Aliases: []string{"SECURITYNAME", "NAME"}, Required: true},
+			{Name: "DATE OF LISTING", Aliases: []string{"DATEOFLISTING"}},
+			{Name: "MARKET LOT", Aliases: []string{"MARKETLOT"}},
+			{Name: "ISIN NUMBER", Aliases: []string{"ISINNUMBER", "ISIN"}},
+			{Name: "FACE VALUE", Aliases: []string{"FACEVALUE"}},
+		},
+		Key: []string{"SYMBOL"},
+	}
+
+	IndexSchema = Schema{
+		Source: "indices",
+		Columns: []Column{
+			{Name: "SYMBOL", Required: true},
+			{Name: "NAME", Required: true},
+			{Name: "EXCHANGE", Required: true},
+			{Name: "YAHOO SYMBOL"},
+			{Name: "SECTOR"},
+		},
+		Key: []string{"SYMBOL", "EXCHANGE"},
+	}
+
+	AliasSchema = Schema{
+		Source: "aliases",
+		Columns: []Column{
+			{Name: "ALIAS", Required: true},
+			{Name: "SYMBOL", Required: true},
+			{Name: "KIND"},
+			{Name: "EFFECTIVE DATE", Required: true},
+		},
+		Key: []string{"ALIAS", "KIND"},
+	}
+)
+
+// Issue severities. Errors reject the row (or the whole file, for a missing
+// column); warnings keep the row with the offending value left empty
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Issue kinds
+const (
+	IssueMissingColumn = "missing_column"
+	IssueMalformedRow  = "malformed_row"
+	IssueMissingField  = "missing_field"
+	IssueInvalidValue  = "invalid_value"
+	IssueDuplicate     = "duplicate"
+)
+
+// Issue is one problem found while loading a source
+type Issue struct {
+	Line     int    `json:"line,omitempty"` // 1-based line in the file, 0 for the header as a whole
+	Severity string `json:"severity"`
+	Kind     string `json:"kind"`
+	Column   string `json:"column,omitempty"`
+	Message  string `json:"message"`
+}
+
+// ValidationReport is the outcome of loading one source
+type ValidationReport struct {
+	Source string  `json:"source"`
+	File   string  `json:"file"`
+	Rows   int     `json:"rows"`   // data rows read
+	Loaded int     `json:"loaded"` // rows turned into stocks
+	Issues []Issue `json:"issues"`
+}
+
+func (r *ValidationReport) add(line int, severity, kind, column, format string, args ...interface{}) {
+	r.Issues = append(r.Issues, Issue{
+		Line:     line,
+		Severity: severity,
+		Kind:     kind,
+		Column:   column,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// Errors counts the issues of severity error
+func (r *ValidationReport) Errors() int {
+	n := 0
+	for _, issue := range r.Issues {
+		if issue.Severity == SeverityError {
+			n++
+		}
+	}
+	return n
+}
+
+// Warnings counts the issues of severity warning
+func (r *ValidationReport) Warnings() int {
+	return len(r.Issues) - r.Errors()
+}
+
+func (r *ValidationReport) String() string {
+	return fmt.Sprintf("%s (%s): %d rows, %d loaded, %d errors, %d warnings",
+		r.Source, r.File, r.Rows, r.Loaded, r.Errors(), r.Warnings())
+}
+
+// Row is one data row of a CSV source, addressed by schema column name
+type Row struct {
+	Line   int
+	values map[string]string
+}
+
+// Get returns the trimmed value of a column, "" if the file has no such column
+func (r Row) Get(column string) string {
+	return r.values[column]
+}
+
+// readCSV reads a CSV source according to schema. Rows that are malformed,
+// lack a required value or repeat a key are reported and skipped. It only
+// fails if the file cannot be read or its header lacks a required column
+func readCSV(filePath string, schema Schema) ([]Row, *ValidationReport, error) {
+	report := &ValidationReport{Source: schema.Source, File: filePath, Issues: []Issue{}}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, report, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1 // rows of the wrong width are reported, not fatal
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, report, nil
+	}
+	if err != nil {
+		return nil, report, fmt.Errorf("failed to read header: %v", err)
+	}
+
+	positions := make(map[string]int)
+	for i, name := range header {
+		positions[strings.ToUpper(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+
+	columns := make(map[string]int)
+	for _, column := range schema.Columns {
+		for _, name := range append([]string{column.Name}, column.Aliases...) {
+			if i, ok := positions[strings.ToUpper(name)]; ok {
+				columns[column.Name] = i
+				break
+			}
+		}
+		if _, ok := columns[column.Name]; !ok && column.Required {
+			report.add(1, SeverityError, IssueMissingColumn, column.Name, "required column %q not found in header", column.Name)
+		}
+	}
+	if report.Errors() > 0 {
+		return nil, report, fmt.Errorf("%s: header is missing required columns", filePath)
+	}
+
+	var rows []Row
+	seen := make(map[string]int)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line, _ := reader.FieldPos(0)
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, report, err
+			}
+			report.Rows++
+			report.add(parseErr.StartLine, SeverityError, IssueMalformedRow, "", "%v", parseErr.Err)
+			continue
+		}
+		report.Rows++
+
+		if len(record) != len(header) {
+			report.add(line, SeverityError, IssueMalformedRow, "", "expected %d fields, got %d", len(header), len(record))
+			continue
+		}
+
+		row := Row{Line: line, values: make(map[string]string, len(columns))}
+		valid := true
+		for _, column := range schema.Columns {
+			if i, ok := columns[column.Name]; ok {
+				row.values[column.Name] = strings.TrimSpace(record[i])
+			}
+			if column.Required && row.values[column.Name] == "" {
+				report.add(line, SeverityError, IssueMissingField, column.Name, "missing required value")
+				valid = false
+			}
+		}
+		if !valid {
+			continue
+		}
+
+		if len(schema.Key) > 0 {
+			parts := make([]string, len(schema.Key))
+			for i, column := range schema.Key {
+				parts[i] = strings.ToUpper(row.values[column])
+			}
+			key := strings.Join(parts, "/")
+			if first, ok := seen[key]; ok {
+				report.add(line, SeverityError, IssueDuplicate, strings.Join(schema.Key, "/"), "%s already defined on line %d", key, first)
+				continue
+			}
+			seen[key] = line
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, report, nil
+}
@@ -0,0 +1,105 @@
+package loader
+
+import (
+	"os"
+	"testing"
+)
+
+// writeTempFile writes content to a temporary file removed at the end of the test
+func writeTempFile(t *testing.T, content string) string {
+	t.Helper()
+	tmpfile, err := os.CreateTemp("", "loader_*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(tmpfile.Name()) })
+
+	if _, err := tmpfile.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tmpfile.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return tmpfile.Name()
+}
+
+// issueKinds lists the kinds of the issues in a report, in order
+func issueKinds(report *ValidationReport) []string {
+	var kinds []string
+	for _, issue := range report.Issues {
+		kinds = append(kinds, issue.Kind)
+	}
+	return kinds
+}
+
+func TestLoadStocksValidation(t *testing.T) {
+	// Columns out of order, a short row, a row missing its name and a duplicate
+	path := writeTempFile(t, `Exchange,Symbol,Name,Type,Brand
+NSE,RELIANCE,Reliance Industries Limited,Stock,Jio
+NSE,ITC,ITC Limited,Stock
+NSE,TCS,,Stock,Tata
+NSE,reliance,Reliance Again,Stock,
+BSE,RELIANCE,Reliance Industries Limited,Stock,Jio`)
+
+	stocks, report, err := LoadStocksWithReport(path)
+	if err != nil {
+		t.Fatalf("LoadStocksWithReport failed: %v", err)
+	}
+
+	if len(stocks) != 2 || stocks[0].Symbol != "RELIANCE" || stocks[0].Exchange != "NSE" || stocks[1].Exchange != "BSE" {
+		t.Fatalf("Expected RELIANCE on NSE and BSE, got %+v", stocks)
+	}
+	if stocks[0].Brand != "Jio" {
+		t.Errorf("Expected brand Jio, got %q", stocks[0].Brand)
+	}
+
+	if report.Rows != 5 || report.Loaded != 2 || report.Errors() != 3 {
+		t.Errorf("Unexpected report: %s", report)
+	}
+	want := []string{IssueMalformedRow, IssueMissingField, IssueDuplicate}
+	got := issueKinds(report)
+	if len(got) != len(want) {
+		t.Fatalf("Expected issues %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Expected issues %v, got %v", want, got)
+			break
+		}
+	}
+	if report.Issues[0].Line != 3 || report.Issues[2].Line != 5 {
+		t.Errorf("Unexpected issue lines: %+v", report.Issues)
+	}
+}
+
+func TestLoadStocksMissingColumn(t *testing.T) {
+	path := writeTempFile(t, `Symbol,Name,Type
+RELIANCE,Reliance Industries Limited,Stock`)
+
+	_, report, err := LoadStocksWithReport(path)
+	if err == nil {
+		t.Fatal("Expected an error for the missing Exchange column")
+	}
+	if report.Errors() != 1 || report.Issues[0].Kind != IssueMissingColumn || report.Issues[0].Column != "Exchange" {
+		t.Errorf("Unexpected issues: %+v", report.Issues)
+	}
+}
+
+func TestLoadNSEStocksInvalidValues(t *testing.T) {
+	path := writeTempFile(t, `SYMBOL,NAME OF COMPANY, SERIES, DATE OF LISTING, PAID UP VALUE, MARKET LOT, ISIN NUMBER, FACE VALUE
+RELIANCE,Reliance Industries Limited,EQ,sometime,10,1,INE002A01018,ten`)
+
+	stocks, report, err := LoadNSEStocksWithReport(path)
+	if err != nil {
+		t.Fatalf("LoadNSEStocksWithReport failed: %v", err)
+	}
+	if len(stocks) != 1 {
+		t.Fatalf("Expected the row to be kept, got %d stocks", len(stocks))
+	}
+	if stocks[0].ListingDate != "" || stocks[0].FaceValue != 0 || stocks[0].PaidUpValue != 10 {
+		t.Errorf("Unexpected values: %+v", stocks[0])
+	}
+	if report.Errors() != 0 || report.Warnings() != 2 {
+		t.Errorf("Expected 2 warnings, got %+v", report.Issues)
+	}
+}
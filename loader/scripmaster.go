@@ -0,0 +1,270 @@
+package loader
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"stock-search/models"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ScripMasterURL is where Angel One publishes its instrument list, refreshed daily
+const ScripMasterURL = "https://margincalculator.angelbroking.com/OpenAPI_File/files/OpenAPIScripMaster.json"
+
+// nseCashSeries are the NSE series whose trading symbols carry the series as a
+// suffix in the scrip master, e.g. RELIANCE-EQ
+var nseCashSeries = map[string]bool{"EQ": true, "BE": true, "BZ": true, "SM": true, "ST": true}
+
+// Scrip is one instrument of the Angel One scrip master
+type Scrip struct {
+	Token          string  `json:"token"`
+	Symbol         string  `json:"symbol"` // trading symbol, e.g. RELIANCE-EQ or NIFTY26JUN25FUT
+	Name           string  `json:"name"`   // underlying, e.g. RELIANCE or NIFTY
+	Exchange       string  `json:"exchange"`
+	InstrumentType string  `json:"instrument_type,omitempty"` // "" for cash, e.g. FUTSTK, OPTIDX, AMXIDX
+	Expiry         string  `json:"expiry,omitempty"`          // e.g. 26JUN2025
+	Strike         float64 `json:"strike,omitempty"`          // rupees
+	LotSize        int     `json:"lot_size"`
+	TickSize       float64 `json:"tick_size"` // rupees
+}
+
+// scripMasterEntry is a scrip as Angel One writes it: every value is a string,
+// and strikes and tick sizes are in paise
+type scripMasterEntry struct {
+	Token          string `json:"token"`
+	Symbol         string `json:"symbol"`
+	Name           string `json:"name"`
+	Expiry         string `json:"expiry"`
+	Strike         string `json:"strike"`
+	LotSize        string `json:"lotsize"`
+	InstrumentType string `json:"instrumenttype"`
+	Exchange       string `json:"exch_seg"`
+	TickSize       string `json:"tick_size"`
+}
+
+// ScripMaster maps listings to their Angel One instruments. It is safe for
+// concurrent use and can be reloaded while being read
+type ScripMaster struct {
+	mu     sync.RWMutex
+	scrips map[string]Scrip // keyed by scripKey
+	count  int
+}
+
+func NewScripMaster() *ScripMaster {
+	return &ScripMaster{scrips: make(map[string]Scrip)}
+}
+
+func scripKey(symbol, exchange string) string {
+	return strings.ToUpper(symbol) + "-" + strings.ToUpper(exchange)
+}
+
+// Load replaces the scrips with those of an OpenAPIScripMaster.json file and
+// returns their number. On error the current scrips are kept
+func (m *ScripMaster) Load(filePath string) (int, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	scrips, count, err := readScripMaster(file)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", filePath, err)
+	}
+
+	m.mu.Lock()
+	m.scrips = scrips
+	m.count = count
+	m.mu.Unlock()
+	return count, nil
+}
+
+// readScripMaster decodes the scrip master one entry at a time, as the file
+// lists well over 100,000 instruments. Each scrip is keyed by trading symbol;
+// NSE cash scrips are also keyed by symbol without the series, preferring EQ,
+// and BSE scrips by scrip code, which is their token
+func readScripMaster(r io.Reader) (map[string]Scrip, int, error) {
+	decoder := json.NewDecoder(r)
+	if token, err := decoder.Token(); err != nil || token != json.Delim('[') {
+		return nil, 0, fmt.Errorf("expected a JSON array of scrips")
+	}
+
+	scrips := make(map[string]Scrip)
+	count := 0
+	for decoder.More() {
+		var entry scripMasterEntry
+		if err := decoder.Decode(&entry); err != nil {
+			return nil, 0, fmt.Errorf("scrip %d: %v", count+1, err)
+		}
+		if entry.Token == "" || entry.Symbol == "" || entry.Exchange == "" {
+			continue
+		}
+		scrip := entry.scrip()
+		count++
+
+		scrips[scripKey(scrip.Symbol, scrip.Exchange)] = scrip
+		switch {
+		case scrip.Exchange == "NSE" && scrip.InstrumentType == "":
+			i := strings.LastIndex(scrip.Symbol, "-")
+			if i < 0 || !nseCashSeries[scrip.Symbol[i+1:]] {
+				break
+			}
+			key := scripKey(scrip.Symbol[:i], scrip.Exchange)
+			if _, ok := scrips[key]; !ok || scrip.Symbol[i+1:] == "EQ" {
+				scrips[key] = scrip
+			}
+		case scrip.Exchange == "BSE":
+			scrips[scripKey(scrip.Token, scrip.Exchange)] = scrip
+		}
+	}
+	if _, err := decoder.Token(); err != nil {
+		return nil, 0, fmt.Errorf("unterminated scrip list: %v", err)
+	}
+	return scrips, count, nil
+}
+
+func (e scripMasterEntry) scrip() Scrip {
+	number := func(value string) float64 {
+		f, _ := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		return f
+	}
+	scrip := Scrip{
+		Token:          e.Token,
+		Symbol:         strings.ToUpper(e.Symbol),
+		Name:           e.Name,
+		Exchange:       strings.ToUpper(e.Exchange),
+		InstrumentType: e.InstrumentType,
+		Expiry:         e.Expiry,
+		LotSize:        int(number(e.LotSize)),
+		TickSize:       number(e.TickSize) / 100,
+	}
+	// Cash scrips have a strike of -1
+	if strike := number(e.Strike); strike > 0 {
+		scrip.Strike = strike / 100
+	}
+	return scrip
+}
+
+// Get returns the scrip of a listing: an NSE symbol, a BSE scrip code or any
+// trading symbol of the scrip master
+func (m *ScripMaster) Get(symbol, exchange string) (Scrip, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	scrip, ok := m.scrips[scripKey(symbol, exchange)]
+	return scrip, ok
+}
+
+// Lookup returns the Angel One token of a listing, or "" if unknown. It is a
+// TokenLookup
+func (m *ScripMaster) Lookup(symbol, exchange string) string {
+	scrip, _ := m.Get(symbol, exchange)
+	return scrip.Token
+}
+
+// Contracts returns the futures and options contracts of the scrip master,
+// ordered by trading symbol
+func (m *ScripMaster) Contracts() []models.Contract {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var contracts []models.Contract
+	for key, scrip := range m.scrips {
+		// Each scrip is listed once under its trading symbol
+		if key != scripKey(scrip.Symbol, scrip.Exchange) {
+			continue
+		}
+		if contract, ok := scrip.contract(); ok {
+			contracts = append(contracts, contract)
+		}
+	}
+	sort.Slice(contracts, func(i, j int) bool { return contracts[i].Symbol < contracts[j].Symbol })
+	return contracts
+}
+
+// contract converts a futures or options scrip. Options end their trading
+// symbol with the option type, e.g. NIFTY26JUN2524500CE
+func (s Scrip) contract() (models.Contract, bool) {
+	contract := models.Contract{
+		Symbol:         s.Symbol,
+		Token:          s.Token,
+		Exchange:       s.Exchange,
+		Underlying:     strings.ToUpper(s.Name),
+		InstrumentType: s.InstrumentType,
+		LotSize:        s.LotSize,
+		TickSize:       s.TickSize,
+	}
+	switch {
+	case strings.HasPrefix(s.InstrumentType, "FUT"):
+	case strings.HasPrefix(s.InstrumentType, "OPT"):
+		contract.Strike = s.Strike
+		switch {
+		case strings.HasSuffix(s.Symbol, models.OptionCall):
+			contract.OptionType = models.OptionCall
+		case strings.HasSuffix(s.Symbol, models.OptionPut):
+			contract.OptionType = models.OptionPut
+		default:
+			return contract, false
+		}
+	default:
+		return contract, false
+	}
+
+	expiry, err := time.Parse("02Jan2006", s.Expiry)
+	if err != nil || contract.Underlying == "" {
+		return contract, false
+	}
+	contract.Expiry = expiry.Format("2006-01-02")
+	return contract, true
+}
+
+// Len returns the number of scrips loaded
+func (m *ScripMaster) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.count
+}
+
+// DownloadScripMaster fetches the scrip master from url and saves it to
+// filePath, replacing the file only once the download is complete and valid.
+// It returns the number of scrips
+func DownloadScripMaster(url, filePath string) (int, error) {
+	client := &http.Client{Timeout: 5 * time.Minute} // the file is tens of megabytes
+	resp, err := client.Get(url)
+	if err != nil {
+		return 0, fmt.Errorf("failed to download scrip master: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("scrip master download returned status: %s", resp.Status)
+	}
+
+	tmpPath := filePath + ".tmp"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmpPath)
+
+	_, err = io.Copy(tmp, resp.Body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to save scrip master: %v", err)
+	}
+
+	count, err := NewScripMaster().Load(tmpPath)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
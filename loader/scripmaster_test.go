@@ -0,0 +1,63 @@
+package loader
+
+import (
+	"testing"
+)
+
+func TestScripMaster(t *testing.T) {
+	path := writeTempFile(t, `[
+{"token":"2885","symbol":"RELIANCE-EQ","name":"RELIANCE","expiry":"","strike":"-1.000000","lotsize":"1","instrumenttype":"","exch_seg":"NSE","tick_size":"10.000000"},
+{"token":"17847","symbol":"RELIANCE-BL","name":"RELIANCE","expiry":"","strike":"-1.000000","lotsize":"1","instrumenttype":"","exch_seg":"NSE","tick_size":"10.000000"},
+{"token":"4329","symbol":"SMALLCO-BE","name":"SMALLCO","expiry":"","strike":"-1.000000","lotsize":"1","instrumenttype":"","exch_seg":"NSE","tick_size":"1.000000"},
+{"token":"500325","symbol":"RELIANCE","name":"RELIANCE","expiry":"","strike":"-1.000000","lotsize":"1","instrumenttype":"","exch_seg":"BSE","tick_size":"5.000000"},
+{"token":"35001","symbol":"NIFTY26JUN2525000CE","name":"NIFTY","expiry":"26JUN2025","strike":"2500000.000000","lotsize":"75","instrumenttype":"OPTIDX","exch_seg":"NFO","tick_size":"5.000000"},
+{"token":"","symbol":"BROKEN","name":"","expiry":"","strike":"","lotsize":"","instrumenttype":"","exch_seg":"NSE","tick_size":""}
+]`)
+
+	scrips := NewScripMaster()
+	n, err := scrips.Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if n != 5 || scrips.Len() != 5 {
+		t.Errorf("Expected 5 scrips, got %d", n)
+	}
+
+	if token := scrips.Lookup("reliance", "NSE"); token != "2885" {
+		t.Errorf("Expected the EQ token for RELIANCE on NSE, got %q", token)
+	}
+	if token := scrips.Lookup("RELIANCE-BL", "NSE"); token != "17847" {
+		t.Errorf("Expected trading symbols to resolve, got %q", token)
+	}
+	if token := scrips.Lookup("SMALLCO", "NSE"); token != "4329" {
+		t.Errorf("Expected a BE symbol without its series to resolve, got %q", token)
+	}
+	if token := scrips.Lookup("500325", "BSE"); token != "500325" {
+		t.Errorf("Expected BSE scrip codes to resolve, got %q", token)
+	}
+	if token := scrips.Lookup("TCS", "NSE"); token != "" {
+		t.Errorf("Expected no token for an unknown symbol, got %q", token)
+	}
+
+	option, ok := scrips.Get("NIFTY26JUN2525000CE", "NFO")
+	if !ok || option.Strike != 25000 || option.LotSize != 75 || option.TickSize != 0.05 || option.InstrumentType != "OPTIDX" {
+		t.Errorf("Unexpected option: %+v", option)
+	}
+	if equity, _ := scrips.Get("RELIANCE", "NSE"); equity.Strike != 0 || equity.TickSize != 0.1 {
+		t.Errorf("Unexpected equity: %+v", equity)
+	}
+
+	contracts := scrips.Contracts()
+	if len(contracts) != 1 || contracts[0].Underlying != "NIFTY" || contracts[0].Expiry != "2025-06-26" ||
+		contracts[0].OptionType != "CE" || contracts[0].Strike != 25000 || contracts[0].Token != "35001" {
+		t.Errorf("Expected the NIFTY option as the only contract, got %+v", contracts)
+	}
+
+	// A broken file keeps the scrips already loaded
+	if _, err := scrips.Load(writeTempFile(t, `{"token":"1"}`)); err == nil {
+		t.Error("Expected an error for a file that is not a scrip list")
+	}
+	if scrips.Lookup("RELIANCE", "NSE") != "2885" {
+		t.Error("Expected the previous scrips to be kept")
+	}
+}
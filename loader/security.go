@@ -0,0 +1,185 @@
+package loader
+
+import (
+	"stock-search/models"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// companyNameWords rewrites abbreviations in company names, and drops words
+// mapped to "", so "SUN PHARMACEUTICAL INDS. LTD." and "Sun Pharmaceutical
+// Industries Limited" normalise to the same key
+var companyNameWords = map[string]string{
+	"LTD":     "",
+	"LIMITED": "",
+	"THE":     "",
+	"CO":      "COMPANY",
+	"CORP":    "CORPORATION",
+	"CORPN":   "CORPORATION",
+	"INDS":    "INDUSTRIES",
+	"INTL":    "INTERNATIONAL",
+	"&":       "AND",
+}
+
+// normalizeCompanyName reduces a company name to a key for matching names
+// written differently by the two exchanges
+func normalizeCompanyName(name string) string {
+	name = strings.ToUpper(strings.ReplaceAll(name, "&", " & "))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '&' {
+			return r
+		}
+		if r == '\'' {
+			return -1 // DR. REDDY'S -> DR REDDYS
+		}
+		return ' '
+	}, name)
+
+	var words []string
+	for _, word := range strings.Fields(name) {
+		if replacement, ok := companyNameWords[word]; ok {
+			word = replacement
+		}
+		if word != "" {
+			words = append(words, word)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// LinkListings fills in the ISIN of listings that lack one, usually BSE rows,
+// which are keyed by scrip code. A listing is linked to the NSE listing with the
+// same symbol, else the same normalised company name, else a name that is just
+// the NSE symbol ("TCS LTD." is TCS). Indices have no ISIN and are left alone
+func LinkListings(stocks []models.Stock) {
+	bySymbol := make(map[string]string)
+	byName := make(map[string]string)
+	for _, stock := range stocks {
+		if stock.Exchange != "NSE" || stock.ISIN == "" {
+			continue
+		}
+		bySymbol[strings.ToUpper(stock.Symbol)] = stock.ISIN
+		byName[normalizeCompanyName(stock.Name)] = stock.ISIN
+	}
+
+	for i := range stocks {
+		if stocks[i].ISIN != "" || stocks[i].Type == models.TypeIndex {
+			continue
+		}
+		name := normalizeCompanyName(stocks[i].Name)
+		if isin, ok := bySymbol[strings.ToUpper(stocks[i].Symbol)]; ok {
+			stocks[i].ISIN = isin
+		} else if isin, ok := byName[name]; ok {
+			stocks[i].ISIN = isin
+		} else if isin, ok := bySymbol[strings.ReplaceAll(name, " ", "")]; ok {
+			stocks[i].ISIN = isin
+		}
+		if stocks[i].ISIN != "" {
+			setProvenance(&stocks[i], "isin", ProvenanceLinked, "")
+		}
+	}
+}
+
+// IsScripCode reports whether a BSE symbol is a numeric scrip code
+func IsScripCode(symbol string) bool {
+	if symbol == "" {
+		return false
+	}
+	for _, r := range symbol {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// TokenLookup returns the Angel One token of a listing, or "" if unknown
+type TokenLookup func(symbol, exchange string) string
+
+// SecurityMaster maps ISINs to securities and their listings on NSE and BSE.
+// It is safe for concurrent use and can be rebuilt while being read
+type SecurityMaster struct {
+	tokens TokenLookup
+
+	mu         sync.RWMutex
+	securities map[string]models.Security
+}
+
+func NewSecurityMaster(tokens TokenLookup) *SecurityMaster {
+	return &SecurityMaster{tokens: tokens, securities: make(map[string]models.Security)}
+}
+
+// Update rebuilds the master from stocks, which should already be linked with
+// LinkListings, and returns the number of securities. Each exchange contributes
+// one listing per security; a BSE scrip code is preferred over a BSE row keyed
+// by NSE symbol
+func (m *SecurityMaster) Update(stocks []models.Stock) int {
+	securities := make(map[string]models.Security)
+	onBSE := make(map[string]bool)
+	for _, stock := range stocks {
+		// Mutual fund schemes are not exchange listings
+		if stock.ISIN == "" || stock.Exchange == models.ExchangeAMFI {
+			continue
+		}
+		security := securities[stock.ISIN]
+		security.ISIN = stock.ISIN
+
+		switch stock.Exchange {
+		case "NSE":
+			security.NSESymbol = stock.Symbol
+			security.Name = stock.Name // NSE names are properly cased
+		case "BSE":
+			onBSE[stock.ISIN] = true
+			if IsScripCode(stock.Symbol) {
+				security.BSECode = stock.Symbol
+			}
+		}
+		if security.Name == "" {
+			security.Name = stock.Name
+		}
+		securities[stock.ISIN] = security
+	}
+
+	for isin, security := range securities {
+		if security.NSESymbol != "" {
+			security.Listings = append(security.Listings, m.listing(security.NSESymbol, "NSE", security.NSESymbol))
+		}
+		if security.BSECode != "" {
+			security.Listings = append(security.Listings, m.listing(security.BSECode, "BSE", security.NSESymbol))
+		} else if security.NSESymbol != "" && onBSE[isin] {
+			security.Listings = append(security.Listings, m.listing(security.NSESymbol, "BSE", security.NSESymbol))
+		}
+		securities[isin] = security
+	}
+
+	m.mu.Lock()
+	m.securities = securities
+	m.mu.Unlock()
+	return len(securities)
+}
+
+// listing builds one exchange listing. Token tables may key BSE listings by NSE
+// symbol instead of scrip code, so both are tried
+func (m *SecurityMaster) listing(symbol, exchange, nseSymbol string) models.Listing {
+	listing := models.Listing{
+		Exchange:    exchange,
+		Symbol:      symbol,
+		YahooTicker: models.YahooTicker(symbol, exchange),
+	}
+	if m.tokens != nil {
+		listing.AngelOneToken = m.tokens(symbol, exchange)
+		if listing.AngelOneToken == "" && nseSymbol != "" && nseSymbol != symbol {
+			listing.AngelOneToken = m.tokens(nseSymbol, exchange)
+		}
+	}
+	return listing
+}
+
+// Get returns the security with the given ISIN
+func (m *SecurityMaster) Get(isin string) (models.Security, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	security, ok := m.securities[strings.ToUpper(isin)]
+	return security, ok
+}
@@ -0,0 +1,58 @@
+package loader
+
+import (
+	"stock-search/models"
+	"testing"
+)
+
+func TestSecurityMaster(t *testing.T) {
+	stocks := []models.Stock{
+		{Symbol: "RELIANCE", Name: "Reliance Industries Limited", Exchange: "NSE", ISIN: "INE002A01018"},
+		{Symbol: "SUNPHARMA", Name: "Sun Pharmaceutical Industries Limited", Exchange: "NSE", ISIN: "INE044A01036"},
+		{Symbol: "TCS", Name: "Tata Consultancy Services Limited", Exchange: "NSE", ISIN: "INE467B01029"},
+		{Symbol: "500325", Name: "RELIANCE INDUSTRIES LTD.", Exchange: "BSE"},
+		{Symbol: "524715", Name: "SUN PHARMACEUTICAL INDS. LTD.", Exchange: "BSE"},
+		{Symbol: "532540", Name: "TCS LTD.", Exchange: "BSE"},
+		{Symbol: "TCS", Name: "Tata Consultancy Services Limited", Exchange: "BSE"},
+		{Symbol: "500312", Name: "OMEGA HEALTHCARE INVESTORS INC", Exchange: "BSE"},
+	}
+	LinkListings(stocks)
+
+	want := []string{"INE002A01018", "INE044A01036", "INE467B01029", "INE467B01029", ""}
+	for i, isin := range want {
+		if got := stocks[i+3].ISIN; got != isin {
+			t.Errorf("%s linked to %q, want %q", stocks[i+3].Symbol, got, isin)
+		}
+	}
+
+	tokens := func(symbol, exchange string) string {
+		if symbol == "TCS" {
+			return exchange + "-token"
+		}
+		return ""
+	}
+	master := NewSecurityMaster(tokens)
+	if n := master.Update(stocks); n != 3 {
+		t.Errorf("Expected 3 securities, got %d", n)
+	}
+
+	security, ok := master.Get("ine467b01029")
+	if !ok {
+		t.Fatal("Expected TCS in the security master")
+	}
+	if security.NSESymbol != "TCS" || security.BSECode != "532540" || security.Name != "Tata Consultancy Services Limited" {
+		t.Errorf("Unexpected security: %+v", security)
+	}
+	wantListings := []models.Listing{
+		{Exchange: "NSE", Symbol: "TCS", YahooTicker: "TCS.NS", AngelOneToken: "NSE-token"},
+		{Exchange: "BSE", Symbol: "532540", YahooTicker: "532540.BO", AngelOneToken: "BSE-token"},
+	}
+	if len(security.Listings) != len(wantListings) {
+		t.Fatalf("Unexpected listings: %+v", security.Listings)
+	}
+	for i, listing := range wantListings {
+		if security.Listings[i] != listing {
+			t.Errorf("Listing %d = %+v, want %+v", i, security.Listings[i], listing)
+		}
+	}
+}
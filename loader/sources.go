@@ -0,0 +1,255 @@
+package loader
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"stock-search/models"
+	"sync"
+)
+
+// Source is one data file named in the sources config
+type Source struct {
+	Name       string `json:"name"`
+	Loader     string `json:"loader"`             // registered loader or enricher reading the file's format
+	Path       string `json:"path"`               // relative to the working directory
+	Exchange   string `json:"exchange,omitempty"` // overrides the exchange set by the loader
+	Precedence int    `json:"precedence"`         // higher wins in the merge, unless a field policy says otherwise
+	Required   bool   `json:"required,omitempty"` // fail instead of warn when the file cannot be loaded
+}
+
+// SourcesConfig lists the listing sources merged into the index and the
+// enrichment feeds applied to the merged listings, each in precedence order,
+// and how records of the same listing are merged
+type SourcesConfig struct {
+	Sources     []Source    `json:"sources"`
+	Enrichments []Source    `json:"enrichments"`
+	Merge       MergePolicy `json:"merge"`
+}
+
+// LoaderFunc reads the listings of a source
+type LoaderFunc func(src Source) ([]models.Stock, *ValidationReport, error)
+
+// EnricherFunc reads an enrichment feed and applies it to stocks in place,
+// returning the number of entries it read
+type EnricherFunc func(src Source, stocks []models.Stock) (int, error)
+
+// InputsFunc lists the files a loader or enricher reads besides src.Path
+type InputsFunc func(src Source) []string
+
+var (
+	registryMu sync.RWMutex
+	loaders    = make(map[string]LoaderFunc)
+	enrichers  = make(map[string]EnricherFunc)
+	inputs     = make(map[string]InputsFunc)
+)
+
+// RegisterLoader makes a listing loader available to sources configs under name.
+// It panics if the name is already taken
+func RegisterLoader(name string, fn LoaderFunc) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := loaders[name]; ok {
+		panic("loader: RegisterLoader called twice for " + name)
+	}
+	loaders[name] = fn
+}
+
+// RegisterEnricher makes an enricher available to sources configs under name.
+// It panics if the name is already taken
+func RegisterEnricher(name string, fn EnricherFunc) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := enrichers[name]; ok {
+		panic("loader: RegisterEnricher called twice for " + name)
+	}
+	enrichers[name] = fn
+}
+
+// RegisterInputs declares the further files read by the loader or enricher
+// registered under name, so they are watched along with the source's path
+func RegisterInputs(name string, fn InputsFunc) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	inputs[name] = fn
+}
+
+func lookupLoader(name string) (LoaderFunc, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	fn, ok := loaders[name]
+	return fn, ok
+}
+
+func lookupEnricher(name string) (EnricherFunc, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	fn, ok := enrichers[name]
+	return fn, ok
+}
+
+// Built-in loaders for the bundled data files
+func init() {
+	RegisterLoader("nse_csv", func(src Source) ([]models.Stock, *ValidationReport, error) {
+		return LoadNSEStocksWithReport(src.Path)
+	})
+	RegisterLoader("bse_csv", func(src Source) ([]models.Stock, *ValidationReport, error) {
+		return LoadBSEStocksWithReport(src.Path)
+	})
+	RegisterLoader("curated_csv", func(src Source) ([]models.Stock, *ValidationReport, error) {
+		return LoadStocksWithReport(src.Path)
+	})
+	RegisterEnricher("brand_mappings", func(src Source, stocks []models.Stock) (int, error) {
+		mappings, err := LoadBrandMappings(src.Path)
+		if err != nil {
+			return 0, err
+		}
+		ApplyBrandMappings(stocks, mappings)
+		return len(mappings), nil
+	})
+}
+
+// LoadSourcesConfig reads a sources config and checks that every source names
+// a registered loader
+func LoadSourcesConfig(filePath string) (*SourcesConfig, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var config SourcesConfig
+	if err := json.NewDecoder(file).Decode(&config); err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool)
+	check := func(src Source, registered bool) error {
+		if src.Name == "" {
+			return fmt.Errorf("source without a name")
+		}
+		if names[src.Name] {
+			return fmt.Errorf("source %q: defined twice", src.Name)
+		}
+		names[src.Name] = true
+		if src.Path == "" {
+			return fmt.Errorf("source %q: missing path", src.Name)
+		}
+		if !registered {
+			return fmt.Errorf("source %q: unknown loader %q", src.Name, src.Loader)
+		}
+		return nil
+	}
+	for _, src := range config.Sources {
+		_, ok := lookupLoader(src.Loader)
+		if err := check(src, ok); err != nil {
+			return nil, err
+		}
+	}
+	for _, src := range config.Enrichments {
+		_, ok := lookupEnricher(src.Loader)
+		if err := check(src, ok); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := config.Merge.validate(names); err != nil {
+		return nil, err
+	}
+
+	// Equal precedence keeps the order of the file
+	sort.SliceStable(config.Sources, func(i, j int) bool {
+		return config.Sources[i].Precedence < config.Sources[j].Precedence
+	})
+	sort.SliceStable(config.Enrichments, func(i, j int) bool {
+		return config.Enrichments[i].Precedence < config.Enrichments[j].Precedence
+	})
+
+	return &config, nil
+}
+
+// Paths lists the files of every source, for watching them
+func (c *SourcesConfig) Paths() []string {
+	var paths []string
+	seen := make(map[string]bool)
+	add := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+
+	for _, src := range append(append([]Source{}, c.Sources...), c.Enrichments...) {
+		add(src.Path)
+		registryMu.RLock()
+		fn := inputs[src.Loader]
+		registryMu.RUnlock()
+		if fn != nil {
+			for _, path := range fn(src) {
+				add(path)
+			}
+		}
+	}
+	return paths
+}
+
+// LoadSource reads a listing source with its registered loader
+func LoadSource(src Source) ([]models.Stock, *ValidationReport, error) {
+	fn, ok := lookupLoader(src.Loader)
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown loader %q", src.Loader)
+	}
+
+	stocks, report, err := fn(src)
+	if err != nil {
+		return nil, report, err
+	}
+	if report != nil {
+		report.Source = src.Name
+	}
+	if src.Exchange != "" {
+		for i := range stocks {
+			stocks[i].Exchange = src.Exchange
+		}
+	}
+	return stocks, report, nil
+}
+
+// Enrich applies an enrichment feed to stocks with its registered enricher and
+// records the feed in the provenance of the fields it changed
+func Enrich(src Source, stocks []models.Stock) (int, error) {
+	fn, ok := lookupEnricher(src.Loader)
+	if !ok {
+		return 0, fmt.Errorf("unknown enricher %q", src.Loader)
+	}
+
+	before := make([]models.Stock, len(stocks))
+	copy(before, stocks)
+	n, err := fn(src, stocks)
+	if err != nil {
+		return n, err
+	}
+	for i := range stocks {
+		recordProvenance(&before[i], &stocks[i], src.Name)
+	}
+	return n, nil
+}
+
+// ApplyBrandMappings adds the brands mapped to each stock's symbol, or to a
+// former symbol, to its Brand
+func ApplyBrandMappings(stocks []models.Stock, mappings map[string]string) {
+	for i := range stocks {
+		for _, key := range symbolKeys(stocks[i]) {
+			brands, ok := mappings[key]
+			if !ok {
+				continue
+			}
+			if stocks[i].Brand != "" {
+				stocks[i].Brand += ", " + brands
+			} else {
+				stocks[i].Brand = brands
+			}
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package loader
+
+import (
+	"stock-search/models"
+	"strings"
+	"testing"
+)
+
+// registerTestLoader registers a loader until the end of the test
+func registerTestLoader(t *testing.T, name string, fn LoaderFunc) {
+	t.Helper()
+	RegisterLoader(name, fn)
+	t.Cleanup(func() {
+		registryMu.Lock()
+		defer registryMu.Unlock()
+		delete(loaders, name)
+	})
+}
+
+// registerTestEnricher registers an enricher until the end of the test
+func registerTestEnricher(t *testing.T, name string, fn EnricherFunc) {
+	t.Helper()
+	RegisterEnricher(name, fn)
+	t.Cleanup(func() {
+		registryMu.Lock()
+		defer registryMu.Unlock()
+		delete(enrichers, name)
+	})
+}
+
+func TestLoadSourcesConfig(t *testing.T) {
+	csvPath := writeTempFile(t, `SYMBOL,NAME OF COMPANY
+RELIANCE,Reliance Industries Limited`)
+
+	registerTestLoader(t, "test_feed", func(src Source) ([]models.Stock, *ValidationReport, error) {
+		return []models.Stock{{Symbol: "FEED", Exchange: "NSE"}}, &ValidationReport{}, nil
+	})
+
+	configPath := writeTempFile(t, `{
+		"sources": [
+			{"name": "curated", "loader": "test_feed", "path": "unused", "precedence": 100},
+			{"name": "msei", "loader": "bse_csv", "path": "`+csvPath+`", "exchange": "MSEI", "precedence": 10}
+		],
+		"enrichments": [
+			{"name": "brands", "loader": "brand_mappings", "path": "data/brand_mappings.json"}
+		]
+	}`)
+
+	config, err := LoadSourcesConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadSourcesConfig failed: %v", err)
+	}
+	if len(config.Sources) != 2 || config.Sources[0].Name != "msei" || config.Sources[1].Name != "curated" {
+		t.Fatalf("Expected sources in precedence order, got %+v", config.Sources)
+	}
+	if paths := config.Paths(); len(paths) != 3 || paths[2] != "data/brand_mappings.json" {
+		t.Errorf("Unexpected paths: %v", paths)
+	}
+
+	stocks, report, err := LoadSource(config.Sources[0])
+	if err != nil {
+		t.Fatalf("LoadSource failed: %v", err)
+	}
+	if len(stocks) != 1 || stocks[0].Symbol != "RELIANCE" || stocks[0].Exchange != "MSEI" {
+		t.Errorf("Expected RELIANCE on MSEI, got %+v", stocks)
+	}
+	if report.Source != "msei" {
+		t.Errorf("Expected the report to name the source, got %q", report.Source)
+	}
+
+	stocks, _, err = LoadSource(config.Sources[1])
+	if err != nil || len(stocks) != 1 || stocks[0].Symbol != "FEED" {
+		t.Errorf("Expected the registered loader to be used, got %+v, %v", stocks, err)
+	}
+}
+
+func TestLoadSourcesConfigUnknownLoader(t *testing.T) {
+	configPath := writeTempFile(t, `{"sources": [{"name": "lse", "loader": "lse_csv", "path": "data/lse.csv"}]}`)
+
+	_, err := LoadSourcesConfig(configPath)
+	if err == nil || !strings.Contains(err.Error(), "unknown loader") {
+		t.Errorf("Expected an unknown loader error, got %v", err)
+	}
+}
+
+func TestApplyBrandMappings(t *testing.T) {
+	stocks := []models.Stock{
+		{Symbol: "RELIANCE", Brand: "Jio"},
+		{Symbol: "ITC"},
+		{Symbol: "TCS"},
+	}
+	ApplyBrandMappings(stocks, map[string]string{"RELIANCE": "Reliance Digital", "ITC": "Aashirvaad"})
+
+	if stocks[0].Brand != "Jio, Reliance Digital" || stocks[1].Brand != "Aashirvaad" || stocks[2].Brand != "" {
+		t.Errorf("Unexpected brands: %+v", stocks)
+	}
+}
@@ -0,0 +1,94 @@
+package loader
+
+import (
+	"log"
+	"stock-search/models"
+	"strings"
+	"time"
+)
+
+// tradeToTradeSeries are the NSE series settled trade for trade
+var tradeToTradeSeries = map[string]bool{"BE": true, "BZ": true}
+
+// ListingStatus is one row of the exchange status file
+type ListingStatus struct {
+	Status string
+	Since  string
+	Reason string
+}
+
+func init() {
+	RegisterEnricher("listing_status", func(src Source, stocks []models.Stock) (int, error) {
+		statuses, err := LoadListingStatus(src.Path)
+		if err != nil {
+			return 0, err
+		}
+		ApplyListingStatus(stocks, statuses)
+		return len(statuses), nil
+	})
+}
+
+// LoadListingStatus reads the exchange status file (SYMBOL, EXCHANGE, STATUS,
+// SINCE, REASON), keyed by statusKey. A row without an exchange applies to the
+// symbol on every exchange
+func LoadListingStatus(filePath string) (map[string]ListingStatus, error) {
+	rows, report, err := readCSV(filePath, StatusSchema)
+	if err != nil {
+		return nil, err
+	}
+	for _, issue := range report.Issues {
+		log.Printf("Warning: Listing status: line %d: %s", issue.Line, issue.Message)
+	}
+
+	statuses := make(map[string]ListingStatus)
+	for _, row := range rows {
+		status := strings.ToLower(strings.ReplaceAll(row.Get("STATUS"), "-", "_"))
+		switch status {
+		case models.StatusActive, models.StatusSuspended, models.StatusDelisted, models.StatusTradeToTrade:
+		default:
+			log.Printf("Warning: Listing status: line %d: unknown status %q", row.Line, row.Get("STATUS"))
+			continue
+		}
+		since := row.Get("SINCE")
+		if _, err := time.Parse("2006-01-02", since); since != "" && err != nil {
+			log.Printf("Warning: Listing status: line %d: %q is not a YYYY-MM-DD date", row.Line, since)
+			since = ""
+		}
+		statuses[statusKey(row.Get("SYMBOL"), row.Get("EXCHANGE"))] = ListingStatus{
+			Status: status,
+			Since:  since,
+			Reason: row.Get("REASON"),
+		}
+	}
+	return statuses, nil
+}
+
+func statusKey(symbol, exchange string) string {
+	return strings.ToUpper(symbol) + "-" + strings.ToUpper(exchange)
+}
+
+// ApplyListingStatus sets the status of every stock: the row for its exchange,
+// else the row for any exchange, else trade-to-trade for NSE series settled that
+// way, else active. Rows keyed by a former symbol still apply
+func ApplyListingStatus(stocks []models.Stock, statuses map[string]ListingStatus) {
+	for i := range stocks {
+		status, found := ListingStatus{}, false
+		for _, key := range symbolKeys(stocks[i]) {
+			if status, found = statuses[statusKey(key, stocks[i].Exchange)]; found {
+				break
+			}
+			if status, found = statuses[statusKey(key, "")]; found {
+				break
+			}
+		}
+		if !found {
+			status = ListingStatus{Status: models.StatusActive}
+			if tradeToTradeSeries[stocks[i].Series] {
+				status.Status = models.StatusTradeToTrade
+			}
+		}
+		stocks[i].Status = status.Status
+		stocks[i].StatusSince = status.Since
+		stocks[i].StatusReason = status.Reason
+	}
+}
@@ -0,0 +1,47 @@
+package loader
+
+import (
+	"stock-search/models"
+	"testing"
+)
+
+func TestListingStatus(t *testing.T) {
+	path := writeTempFile(t, `SYMBOL,EXCHANGE,STATUS,SINCE,REASON
+HDFC,,Delisted,2023-07-13,Merged into HDFC Bank
+ARSHIYA,nse,suspended,2023-11-06,
+OLDCO,,dormant,2020-01-01,
+ZOMATO,,trade-to-trade,someday,`)
+
+	statuses, err := LoadListingStatus(path)
+	if err != nil {
+		t.Fatalf("LoadListingStatus failed: %v", err)
+	}
+	if len(statuses) != 3 {
+		t.Fatalf("Expected the unknown status to be skipped, got %+v", statuses)
+	}
+
+	stocks := []models.Stock{
+		{Symbol: "HDFC", Exchange: "BSE"},
+		{Symbol: "ARSHIYA", Exchange: "NSE"},
+		{Symbol: "ARSHIYA", Exchange: "BSE"},
+		{Symbol: "ETERNAL", Exchange: "NSE", Aliases: []models.SymbolAlias{{Alias: "ZOMATO", Kind: models.AliasSymbol}}},
+		{Symbol: "SMALLCO", Exchange: "NSE", Series: "BE"},
+	}
+	ApplyListingStatus(stocks, statuses)
+
+	want := []string{models.StatusDelisted, models.StatusSuspended, models.StatusActive, models.StatusTradeToTrade, models.StatusTradeToTrade}
+	for i, stock := range stocks {
+		if stock.Status != want[i] {
+			t.Errorf("%s on %s: expected %s, got %s", stock.Symbol, stock.Exchange, want[i], stock.Status)
+		}
+	}
+	if stocks[0].StatusSince != "2023-07-13" || stocks[0].StatusReason != "Merged into HDFC Bank" {
+		t.Errorf("Expected the delisting details, got %+v", stocks[0])
+	}
+	if stocks[3].StatusSince != "" {
+		t.Errorf("Expected the invalid date to be dropped, got %q", stocks[3].StatusSince)
+	}
+	if stocks[0].IsActive() || !stocks[2].IsActive() || !stocks[4].IsActive() {
+		t.Error("Expected only suspended and delisted listings to be inactive")
+	}
+}
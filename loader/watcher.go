@@ -0,0 +1,111 @@
+package loader
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// fileState is what the watcher compares between polls
+type fileState struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+func statFile(path string) fileState {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileState{}
+	}
+	return fileState{exists: true, size: info.Size(), modTime: info.ModTime()}
+}
+
+// differs reports whether a file was created, removed or modified between two
+// states
+func (s fileState) differs(other fileState) bool {
+	return s.exists != other.exists || s.size != other.size || !s.modTime.Equal(other.modTime)
+}
+
+// Watcher polls a set of data files and calls onChange after any of them was
+// created, modified or removed. A change is only reported once the files have
+// stayed the same for a whole poll interval, so a file still being written is
+// not loaded half way, and several files saved together trigger a single reload
+type Watcher struct {
+	paths    []string
+	interval time.Duration
+	onChange func()
+
+	state   map[string]fileState
+	pending bool
+
+	stop      chan struct{}
+	done      chan struct{}
+	startOnce sync.Once
+	stopOnce  sync.Once
+}
+
+func NewWatcher(paths []string, interval time.Duration, onChange func()) *Watcher {
+	w := &Watcher{
+		paths:    paths,
+		interval: interval,
+		onChange: onChange,
+		state:    make(map[string]fileState),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	for _, path := range paths {
+		w.state[path] = statFile(path)
+	}
+	return w
+}
+
+// Start begins polling in the background. It does nothing after Stop
+func (w *Watcher) Start() {
+	w.startOnce.Do(func() { go w.run() })
+}
+
+// Stop ends polling and waits for a reload in progress to finish
+func (w *Watcher) Stop() {
+	w.stopOnce.Do(func() { close(w.stop) })
+	// A watcher that was never started has nothing to wait for
+	w.startOnce.Do(func() { close(w.done) })
+	<-w.done
+}
+
+func (w *Watcher) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.poll()
+		}
+	}
+}
+
+// poll compares every file with the previous poll and fires onChange once a
+// detected change has settled
+func (w *Watcher) poll() {
+	changed := false
+	for _, path := range w.paths {
+		state := statFile(path)
+		if state.differs(w.state[path]) {
+			w.state[path] = state
+			changed = true
+		}
+	}
+
+	if changed {
+		w.pending = true
+		return
+	}
+	if w.pending {
+		w.pending = false
+		w.onChange()
+	}
+}
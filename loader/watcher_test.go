@@ -0,0 +1,61 @@
+package loader
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	stocks := filepath.Join(dir, "stocks.csv")
+	brands := filepath.Join(dir, "brands.json")
+	if err := os.WriteFile(stocks, []byte("Symbol,Name,Exchange,Type,Brand\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	changes := make(chan struct{}, 10)
+	watcher := NewWatcher([]string{stocks, brands}, 10*time.Millisecond, func() {
+		changes <- struct{}{}
+	})
+	watcher.Start()
+	defer watcher.Stop()
+
+	select {
+	case <-changes:
+		t.Fatal("Did not expect a change before any file was touched")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Editing one file and creating another is reported as a single change
+	os.WriteFile(stocks, []byte("Symbol,Name,Exchange,Type,Brand\nTCS,Tata Consultancy Services Limited,NSE,Stock,Tata\n"), 0644)
+	os.WriteFile(brands, []byte(`{"TCS": "TCS"}`), 0644)
+
+	select {
+	case <-changes:
+	case <-time.After(time.Second):
+		t.Fatal("Expected a change to be reported")
+	}
+	select {
+	case <-changes:
+		t.Fatal("Expected a single change to be reported")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestWatcherStopWithoutStart(t *testing.T) {
+	watcher := NewWatcher([]string{filepath.Join(t.TempDir(), "stocks.csv")}, time.Hour, func() {})
+
+	stopped := make(chan struct{})
+	go func() {
+		watcher.Stop()
+		watcher.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Expected Stop to return for a watcher that was never started")
+	}
+}
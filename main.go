@@ -1,73 +1,140 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"stock-search/api"
+	"stock-search/credentials"
 	"stock-search/loader"
+	"stock-search/models"
 	"stock-search/search"
+	"strings"
+	"time"
 )
 
+// Data and index locations
+const (
+	indexPath           = "stock_index.bleve"
+	sourcesPath         = "data/sources.json"
+	sectorMappingsPath  = "data/sector_mappings.json"
+	rankingProfilesPath = "data/ranking_profiles.json"
+	scripMasterPath     = "data/angelone_scripmaster.json" // downloaded by the scripmaster command
+	marketDataPath      = "data/market_data.json"
+	candleStorePath     = "data/candles.db"
+)
+
+// backfillPause spaces out the listings of a backfill, to go easy on providers
+const backfillPause = 500 * time.Millisecond
+
+// dataPollInterval is how often the loader inputs are checked for edits
+const dataPollInterval = 5 * time.Second
+
+// maxReportedIssues caps the validation issues logged per data file
+const maxReportedIssues = 10
+
+// strictData makes any validation error in the data files fatal instead of
+// skipping the offending rows
+var strictData = flag.Bool("strict", false, "fail when a data file has invalid rows")
+
 func main() {
-	// Load environment variables (if any)
-	// Load NSE Equity Data (Bulk)
-	nseStocks, err := loader.LoadNSEStocks("data/nse_equity.csv")
-	if err != nil {
-		log.Printf("Warning: Failed to load NSE equity data: %v", err)
+	flag.Parse()
+
+	// Subcommands: "reindex" rebuilds the index offline, "scripmaster" downloads the
+	// Angel One instrument list, "backfill" stores daily candles; no argument
+	// starts the server
+	if flag.NArg() > 0 {
+		switch flag.Arg(0) {
+		case "reindex":
+			reindex(mustLoadSources())
+		case "scripmaster":
+			refreshScripMaster()
+		case "backfill":
+			backfill(mustLoadSources(), flag.Args()[1:])
+		default:
+			log.Fatalf("Unknown command %q (available: reindex, scripmaster, backfill)", flag.Arg(0))
+		}
+		return
 	}
-	fmt.Printf("Loaded %d NSE stocks.\n", len(nseStocks))
 
-	// Load BSE Equity Data (Bulk)
-	bseStocks, err := loader.LoadBSEStocks("data/bse_equity.csv")
+	sources := mustLoadSources()
+	allStocks, err := loadStocks(sources, false)
 	if err != nil {
-		log.Printf("Warning: Failed to load BSE equity data: %v", err)
+		log.Fatalf("Failed to load stocks: %v", err)
 	}
-	fmt.Printf("Loaded %d BSE stocks.\n", len(bseStocks))
 
-	// Load Curated Stocks (with Brand data)
-	curatedStocks, err := loader.LoadStocks("data/stocks.csv")
+	// Initialize Search Engine (Bleve) with semantic search support
+	engine, err := search.NewBleveEngine(indexPath, allStocks, sectorMappingsPath)
 	if err != nil {
-		log.Fatalf("Failed to load curated stocks: %v", err)
+		log.Fatalf("Failed to initialize search engine: %v", err)
 	}
-	fmt.Printf("Loaded %d curated stocks.\n", len(curatedStocks))
-
-	// Merge stocks (Curated should come last to overwrite duplicates in index)
-	allStocks := append(nseStocks, bseStocks...)
-	allStocks = append(allStocks, curatedStocks...)
-	fmt.Printf("Total stocks to index: %d\n", len(allStocks))
+	defer engine.Close()
 
-	// Load Brand Mappings
-	brandMappings, err := loader.LoadBrandMappings("data/brand_mappings.json")
+	// Load Ranking Profiles (selectable per request with profile=)
+	profiles, err := search.LoadRankingProfiles(rankingProfilesPath)
 	if err != nil {
-		log.Printf("Warning: Failed to load brand mappings: %v", err)
+		log.Printf("Warning: Failed to load ranking profiles, using built-in default: %v", err)
 	} else {
-		fmt.Printf("Loaded %d brand mappings.\n", len(brandMappings))
-		// Enrich stocks with brands
-		for i := range allStocks {
-			if brands, ok := brandMappings[allStocks[i].Symbol]; ok {
-				if allStocks[i].Brand != "" {
-					allStocks[i].Brand += ", " + brands
-				} else {
-					allStocks[i].Brand = brands
-				}
-			}
-		}
+		engine.SetRankingProfiles(profiles)
+		fmt.Printf("Loaded %d ranking profiles.\n", len(profiles))
 	}
 
-	// Initialize Search Engine (Bleve) with semantic search support
-	engine, err := search.NewBleveEngine("stock_index.bleve", allStocks, "data/sector_mappings.json")
-	if err != nil {
-		log.Fatalf("Failed to initialize search engine: %v", err)
+	// Load the Angel One instrument tokens, then build the ISIN security master
+	// linking each company's listings
+	scrips := loader.NewScripMaster()
+	contracts := search.NewContractIndex()
+	loadScripMaster(scrips, contracts)
+	securities := loader.NewSecurityMaster(scrips.Lookup)
+	fmt.Printf("Built security master with %d securities.\n", securities.Update(allStocks))
+
+	// Reload the data files into the live index whenever curators edit them
+	watcher := loader.NewWatcher(
+		sources.Paths(),
+		dataPollInterval,
+		func() { reloadStocks(sources, engine, securities) },
+	)
+	watcher.Start()
+	defer watcher.Stop()
+
+	// Pick up a scrip master refreshed by the scripmaster command; the reload
+	// refreshes the tokens of the security master
+	scripWatcher := loader.NewWatcher([]string{scripMasterPath}, dataPollInterval, func() {
+		loadScripMaster(scrips, contracts)
+		reloadStocks(sources, engine, securities)
+	})
+	scripWatcher.Start()
+	defer scripWatcher.Stop()
+
+	// Market data providers, tried in the order configured per exchange. Their
+	// candles are kept in the candle store, which serves long-range charts
+	marketData := loadMarketData(scrips)
+	if store, err := api.OpenCandleStore(candleStorePath); err != nil {
+		log.Printf("Warning: Candle store unavailable, charts need the providers: %v", err)
+	} else {
+		defer store.Close()
+		marketData.SetCandleStore(store)
 	}
-	defer engine.Close()
 
 	// Initialize API handler
-	handler := api.NewHandler(engine)
+	handler := api.NewHandler(engine, securities, scrips, contracts, marketData)
 
 	// Setup routes
 	http.HandleFunc("/search", handler.Search)
+	http.HandleFunc("/api/suggest", handler.Suggest)
 	http.HandleFunc("/api/stock", handler.GetStock)
+	http.HandleFunc("/api/security/{isin}", handler.GetSecurity)
+
+	// Admin endpoints (require the ADMIN_TOKEN environment variable)
+	// A rebuild re-reads the data files, so the security master is rebuilt with
+	// the index it swaps in
+	admin := api.NewAdminHandler(
+		engine,
+		func() ([]models.Stock, error) { return loadStocks(sources, true) },
+		func(stocks []models.Stock) { securities.Update(stocks) },
+	)
+	http.HandleFunc("/admin/reindex", admin.Reindex)
 
 	// Serve static files with no-cache headers for development
 	fs := http.FileServer(http.Dir("./static"))
@@ -82,3 +149,234 @@ func main() {
 	fmt.Println("Server starting on :8080...")
 	log.Fatal(http.ListenAndServe(":8080", nil))
 }
+
+// mustLoadSources reads the sources config naming the data files to load
+func mustLoadSources() *loader.SourcesConfig {
+	sources, err := loader.LoadSourcesConfig(sourcesPath)
+	if err != nil {
+		log.Fatalf("Failed to load sources config: %v", err)
+	}
+	return sources
+}
+
+// loadStocks runs the data pipeline: the listing sources, merged field by field
+// into one record per listing, then the enrichment feeds. At startup a missing
+// optional source is only a warning; strict loads, used to update a live index,
+// fail instead so a broken file cannot remove its listings from the index. Rows
+// that fail validation are skipped and logged, or fail the load with -strict
+func loadStocks(sources *loader.SourcesConfig, strict bool) ([]models.Stock, error) {
+	var loaded []loader.SourceStocks
+	for _, src := range sources.Sources {
+		stocks, report, err := loader.LoadSource(src)
+		if err != nil && (strict || src.Required) {
+			return nil, fmt.Errorf("failed to load %s: %v", src.Name, err)
+		} else if err != nil {
+			// An optional source that failed is left out of the merge
+			log.Printf("Warning: Failed to load %s, skipping it: %v", src.Name, err)
+			continue
+		}
+		if err := checkReport(report); err != nil {
+			return nil, err
+		}
+		fmt.Printf("Loaded %d stocks from %s.\n", len(stocks), src.Name)
+		loaded = append(loaded, loader.SourceStocks{Source: src, Stocks: stocks})
+	}
+
+	// Combine the records each source has of the same listing
+	allStocks := sources.Merge.Merge(loaded)
+	fmt.Printf("Total stocks to index: %d\n", len(allStocks))
+
+	// Link BSE listings to the ISIN of the same company on NSE
+	loader.LinkListings(allStocks)
+
+	for _, src := range sources.Enrichments {
+		n, err := loader.Enrich(src, allStocks)
+		if err != nil && (strict || src.Required) {
+			return nil, fmt.Errorf("failed to load %s: %v", src.Name, err)
+		} else if err != nil {
+			log.Printf("Warning: Failed to load %s: %v", src.Name, err)
+		} else {
+			fmt.Printf("Applied %d entries from %s.\n", n, src.Name)
+		}
+	}
+
+	return allStocks, nil
+}
+
+// checkReport logs the validation issues of a data file and, with -strict,
+// turns validation errors into a load failure
+func checkReport(report *loader.ValidationReport) error {
+	if len(report.Issues) == 0 {
+		return nil
+	}
+	log.Printf("Validation: %s", report)
+	for i, issue := range report.Issues {
+		if i == maxReportedIssues {
+			log.Printf("  ... and %d more", len(report.Issues)-maxReportedIssues)
+			break
+		}
+		log.Printf("  line %d: %s %s %s: %s", issue.Line, issue.Severity, issue.Kind, issue.Column, issue.Message)
+	}
+	if *strictData && report.Errors() > 0 {
+		return fmt.Errorf("%d invalid rows in %s (strict mode)", report.Errors(), report.File)
+	}
+	return nil
+}
+
+// reloadStocks re-runs the data pipeline and applies the differences to the live
+// index and security master
+func reloadStocks(sources *loader.SourcesConfig, engine *search.BleveEngine, securities *loader.SecurityMaster) {
+	log.Println("Data files changed, reloading...")
+	allStocks, err := loadStocks(sources, true)
+	if err != nil {
+		log.Printf("Warning: Reload failed, keeping current data: %v", err)
+		return
+	}
+
+	summary, err := engine.Sync(allStocks)
+	if err != nil {
+		log.Printf("Warning: Failed to apply reloaded data: %v", err)
+		return
+	}
+	securities.Update(allStocks)
+	log.Printf("Reload complete: %s", summary)
+	if summary.Changed() {
+		log.Printf("Changes: %s", summary.Details(20))
+	}
+}
+
+// reindex rebuilds the index from the data files into a fresh directory and
+// points the server at it on its next start. Use /admin/reindex while the
+// server is running, which holds the index open
+func reindex(sources *loader.SourcesConfig) {
+	allStocks, err := loadStocks(sources, true)
+	if err != nil {
+		log.Fatalf("Failed to load stocks: %v", err)
+	}
+
+	// The current index is only opened to be replaced, so it is not synchronised
+	engine, err := search.OpenBleveEngine(indexPath, sectorMappingsPath)
+	if err != nil {
+		log.Fatalf("Failed to initialize search engine: %v", err)
+	}
+	defer engine.Close()
+
+	if err := engine.Rebuild(allStocks); err != nil {
+		log.Fatalf("Failed to rebuild index: %v", err)
+	}
+	status := engine.RebuildStatus()
+	fmt.Printf("Rebuilt index with %d documents in %s.\n", status.DocCount, status.IndexDir)
+}
+
+// loadScripMaster loads the Angel One scrip master and indexes its futures and
+// options contracts. Without it Angel One data and contract search are
+// unavailable, and charts fall back to Yahoo Finance
+func loadScripMaster(scrips *loader.ScripMaster, contracts *search.ContractIndex) {
+	n, err := scrips.Load(scripMasterPath)
+	if err != nil {
+		log.Printf("Warning: Failed to load Angel One scrip master (run \"go run main.go scripmaster\" to download it): %v", err)
+		return
+	}
+	fmt.Printf("Loaded %d Angel One scrips, with derivatives on %d underlyings.\n", n, contracts.Update(scrips.Contracts()))
+}
+
+// refreshScripMaster downloads the current Angel One scrip master. A running
+// server picks it up automatically
+func refreshScripMaster() {
+	n, err := loader.DownloadScripMaster(loader.ScripMasterURL, scripMasterPath)
+	if err != nil {
+		log.Fatalf("Failed to refresh scrip master: %v", err)
+	}
+	fmt.Printf("Saved %d Angel One scrips to %s.\n", n, scripMasterPath)
+}
+
+// loadMarketData registers the Angel One provider and reads the market data
+// config, falling back to Yahoo Finance
+func loadMarketData(scrips *loader.ScripMaster) *api.MarketData {
+	api.RegisterProvider(api.NewAngelOneProvider(scrips, credentials.NewEnvProvider()))
+	marketData, err := api.LoadMarketData(marketDataPath)
+	if err != nil {
+		log.Printf("Warning: Failed to load market data config, using Yahoo Finance: %v", err)
+		marketData = api.DefaultMarketData()
+	}
+	return marketData
+}
+
+// backfill stores daily candles for the listings named, e.g. RELIANCE or
+// RELIANCE:BSE, or else for every active listing but mutual funds. Listings
+// with stored candles only fetch the days missing. The candle store can only be
+// open in one process, so stop the server first
+func backfill(sources *loader.SourcesConfig, args []string) {
+	flags := flag.NewFlagSet("backfill", flag.ExitOnError)
+	years := flags.Int("years", 5, "years of daily candles to store")
+	flags.Parse(args)
+
+	allStocks, err := loadStocks(sources, false)
+	if err != nil {
+		log.Fatalf("Failed to load stocks: %v", err)
+	}
+
+	var listings []*models.Stock
+	if flags.NArg() == 0 {
+		for i := range allStocks {
+			if allStocks[i].IsActive() && allStocks[i].Type != models.TypeMutualFund {
+				listings = append(listings, &allStocks[i])
+			}
+		}
+	}
+	for _, arg := range flags.Args() {
+		symbol, exchange, _ := strings.Cut(strings.ToUpper(arg), ":")
+		listing := findListing(allStocks, symbol, exchange)
+		if listing == nil {
+			log.Fatalf("Unknown listing %s", arg)
+		}
+		listings = append(listings, listing)
+	}
+
+	scrips := loader.NewScripMaster()
+	if _, err := scrips.Load(scripMasterPath); err != nil {
+		log.Printf("Warning: Failed to load Angel One scrip master, Angel One is unavailable: %v", err)
+	}
+	marketData := loadMarketData(scrips)
+	store, err := api.OpenCandleStore(candleStorePath)
+	if err != nil {
+		log.Fatalf("%v (is the server running?)", err)
+	}
+	defer store.Close()
+	marketData.SetCandleStore(store)
+
+	from := time.Now().AddDate(-*years, 0, 0)
+	failed := 0
+	for i, listing := range listings {
+		if i > 0 {
+			time.Sleep(backfillPause)
+		}
+		n, err := marketData.Backfill(context.Background(), listing, from)
+		if err != nil {
+			log.Printf("Warning: %s:%s: %v", listing.Symbol, listing.Exchange, err)
+			failed++
+			continue
+		}
+		fmt.Printf("[%d/%d] %s:%s: %d daily candles\n", i+1, len(listings), listing.Symbol, listing.Exchange, n)
+	}
+	fmt.Printf("Backfilled %d of %d listings into %s.\n", len(listings)-failed, len(listings), candleStorePath)
+}
+
+// findListing returns the listing of a symbol on an exchange, or on NSE, else
+// any exchange, if exchange is empty
+func findListing(stocks []models.Stock, symbol, exchange string) *models.Stock {
+	var found *models.Stock
+	for i := range stocks {
+		s := &stocks[i]
+		if !strings.EqualFold(s.Symbol, symbol) {
+			continue
+		}
+		if strings.EqualFold(s.Exchange, exchange) || (exchange == "" && s.Exchange == "NSE") {
+			return s
+		}
+		if exchange == "" && found == nil {
+			found = s
+		}
+	}
+	return found
+}
@@ -0,0 +1,26 @@
+package models
+
+// Option types
+const (
+	OptionCall = "CE"
+	OptionPut  = "PE"
+)
+
+// Contract is a futures or options contract on an underlying stock or index
+type Contract struct {
+	Symbol         string  `json:"symbol"` // trading symbol, e.g. NIFTY26JUN2524500CE
+	Token          string  `json:"token"`  // Angel One instrument token
+	Exchange       string  `json:"exchange"`
+	Underlying     string  `json:"underlying"`      // e.g. NIFTY or RELIANCE
+	InstrumentType string  `json:"instrument_type"` // FUTIDX, FUTSTK, OPTIDX or OPTSTK
+	Expiry         string  `json:"expiry"`          // YYYY-MM-DD
+	Strike         float64 `json:"strike,omitempty"`
+	OptionType     string  `json:"option_type,omitempty"` // OptionCall or OptionPut; "" for futures
+	LotSize        int     `json:"lot_size"`
+	TickSize       float64 `json:"tick_size"`
+}
+
+// IsFuture reports whether the contract is a future rather than an option
+func (c Contract) IsFuture() bool {
+	return c.OptionType == ""
+}
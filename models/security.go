@@ -0,0 +1,27 @@
+package models
+
+// Security is one company's equity identified by ISIN, with every exchange listing of it
+type Security struct {
+	ISIN      string    `json:"isin"`
+	Name      string    `json:"name"`
+	NSESymbol string    `json:"nse_symbol,omitempty"`
+	BSECode   string    `json:"bse_code,omitempty"` // BSE scrip code, e.g. "500325"
+	Listings  []Listing `json:"listings"`
+}
+
+// Listing is a security's listing on one exchange
+type Listing struct {
+	Exchange      string `json:"exchange"`
+	Symbol        string `json:"symbol"` // NSE symbol or BSE scrip code
+	YahooTicker   string `json:"yahoo_ticker,omitempty"`
+	AngelOneToken string `json:"angelone_token,omitempty"`
+}
+
+// YahooTicker returns the Yahoo Finance ticker of a listing: the symbol with
+// .NS for NSE or .BO for BSE
+func YahooTicker(symbol, exchange string) string {
+	if exchange == "BSE" {
+		return symbol + ".BO"
+	}
+	return symbol + ".NS" // Default to NSE
+}
@@ -4,10 +4,91 @@ type Stock struct {
 	Symbol          string  `json:"symbol"`
 	Name            string  `json:"name"`
 	Exchange        string  `json:"exchange"`
-	Type            string  `json:"type"`
+	ISIN            string  `json:"isin,omitempty"` // shared by the NSE and BSE listings of one company
+	Type            string  `json:"type"`           // TypeStock, TypeETF, TypeIndex or TypeMutualFund
 	Brand           string  `json:"brand"`
 	Sector          string  `json:"sector"`           // e.g., "Banking", "IT", "Pharma", "Broking"
 	Industry        string  `json:"industry"`         // e.g., "Software Services", "Private Banks"
 	Tags            string  `json:"tags"`             // Searchable keywords, comma-separated
 	PopularityScore float64 `json:"popularity_score"` // 0.0 to 1.0, used for ranking
+
+	// Exchange master data, from the NSE equity list
+	Series      string  `json:"series,omitempty"`       // e.g., "EQ", "BE", "BZ", "SM"
+	ListingDate string  `json:"listing_date,omitempty"` // YYYY-MM-DD
+	PaidUpValue float64 `json:"paid_up_value,omitempty"`
+	MarketLot   int     `json:"market_lot,omitempty"`
+	FaceValue   float64 `json:"face_value,omitempty"`
+
+	// Instrument details of ETFs, indices and mutual fund schemes
+	YahooSymbol    string  `json:"yahoo_symbol,omitempty"`    // chart ticker when it is not the symbol with .NS or .BO, e.g. ^NSEI
+	Underlying     string  `json:"underlying,omitempty"`      // index tracked by an ETF, e.g. "NIFTY 50"
+	FundHouse      string  `json:"fund_house,omitempty"`      // asset management company of a scheme
+	SchemeCategory string  `json:"scheme_category,omitempty"` // e.g. "Equity Scheme - Large Cap Fund"
+	NAV            float64 `json:"nav,omitempty"`
+	NAVDate        string  `json:"nav_date,omitempty"` // YYYY-MM-DD
+
+	// Listing status, from the exchange status file; "" is active
+	Status       string `json:"status,omitempty"`        // StatusActive, StatusSuspended, StatusDelisted or StatusTradeToTrade
+	StatusSince  string `json:"status_since,omitempty"`  // YYYY-MM-DD
+	StatusReason string `json:"status_reason,omitempty"` // e.g. "Non-compliance with listing regulations"
+
+	// Aliases are former symbols and names of the listing, searchable and
+	// resolved by symbol lookups
+	Aliases []SymbolAlias `json:"aliases,omitempty"`
+
+	// RenamedFrom is set when a lookup found the listing by a former symbol.
+	// It is never indexed
+	RenamedFrom *SymbolAlias `json:"renamedFrom,omitempty"`
+
+	// Provenance names the source of each field, keyed by JSON field name, e.g.
+	// {"name": "nse_equity", "brand": "curated+brands"}. Set by the merge stage
+	Provenance map[string]string `json:"provenance,omitempty"`
+}
+
+// Instrument types
+const (
+	TypeStock      = "Stock"
+	TypeETF        = "ETF"
+	TypeIndex      = "Index"
+	TypeMutualFund = "Mutual Fund"
+)
+
+// ExchangeAMFI is the exchange of mutual fund schemes, which are not listed but
+// priced by AMFI. Their symbol is the AMFI scheme code
+const ExchangeAMFI = "AMFI"
+
+// ChartTicker returns the Yahoo Finance ticker of the listing: YahooSymbol if
+// set, else the symbol with its exchange suffix
+func (s Stock) ChartTicker() string {
+	if s.YahooSymbol != "" {
+		return s.YahooSymbol
+	}
+	return YahooTicker(s.Symbol, s.Exchange)
+}
+
+// Listing statuses
+const (
+	StatusActive       = "active"
+	StatusSuspended    = "suspended"
+	StatusDelisted     = "delisted"
+	StatusTradeToTrade = "trade_to_trade" // settled delivery only, e.g. NSE series BE and BZ
+)
+
+// IsActive reports whether the listing can be traded. Trade-to-trade listings
+// are active: they trade, only settlement differs
+func (s Stock) IsActive() bool {
+	return s.Status != StatusSuspended && s.Status != StatusDelisted
+}
+
+// Alias kinds
+const (
+	AliasSymbol = "symbol"
+	AliasName   = "name"
+)
+
+// SymbolAlias is a former symbol or name of a listing, e.g. TATAMOTORS for TMPV
+type SymbolAlias struct {
+	Alias     string `json:"alias"`
+	Kind      string `json:"kind"`      // AliasSymbol or AliasName
+	Effective string `json:"effective"` // YYYY-MM-DD the change took effect
 }
@@ -3,19 +3,62 @@ package search
 import (
 	"fmt"
 	"log"
+	"sort"
 	"stock-search/models"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
 	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/custom"
+	"github.com/blevesearch/bleve/v2/analysis/token/lowercase"
+	"github.com/blevesearch/bleve/v2/analysis/tokenizer/single"
 	"github.com/blevesearch/bleve/v2/mapping"
+	bsearch "github.com/blevesearch/bleve/v2/search"
+	"github.com/blevesearch/bleve/v2/search/query"
 )
 
 type BleveEngine struct {
-	index    bleve.Index
-	semantic *SemanticSearch
+	semantic  *SemanticSearch
+	indexPath string // base path; rebuilt indexes live in versioned directories next to it
+
+	// mu guards the fields below. Queries hold a read lock for their whole
+	// duration, so an index is only closed once no query is using it
+	mu        sync.RWMutex
+	index     bleve.Index
+	indexDir  string // directory of index
+	suggester *Suggester
+	profiles  map[string]RankingProfile
+
+	// writeMu serialises Sync and Rebuild, the only writers of the index
+	writeMu sync.Mutex
+	rebuild rebuildTracker
 }
 
+// NewBleveEngine opens the index at indexPath and synchronises it with stocks
 func NewBleveEngine(indexPath string, stocks []models.Stock, semanticMappingsPath string) (*BleveEngine, error) {
+	engine, err := OpenBleveEngine(indexPath, semanticMappingsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Index only what changed since the index was last synchronised
+	log.Println("Synchronising index...")
+	summary, err := engine.Sync(stocks)
+	if err != nil {
+		engine.Close()
+		return nil, err
+	}
+	log.Printf("Index synchronised: %s", summary)
+
+	return engine, nil
+}
+
+// OpenBleveEngine opens the index at indexPath as it is, without synchronising
+// it. Searches go to whatever it holds, and suggestions are empty, until a Sync
+// or Rebuild
+func OpenBleveEngine(indexPath string, semanticMappingsPath string) (*BleveEngine, error) {
 	// Initialize semantic search
 	semantic, err := NewSemanticSearch(semanticMappingsPath)
 	if err != nil {
@@ -23,57 +66,98 @@ func NewBleveEngine(indexPath string, stocks []models.Stock, semanticMappingsPat
 		// Continue without semantic search
 	}
 
-	// Enrich stocks with sector/industry data from semantic mappings
-	if semantic != nil {
-		for i := range stocks {
-			if stocks[i].Sector == "" {
-				stocks[i].Sector = semantic.GetSectorForSymbol(stocks[i].Symbol)
-			}
-			if stocks[i].Industry == "" {
-				stocks[i].Industry = semantic.GetIndustryForSymbol(stocks[i].Symbol)
-			}
-		}
+	// Follow the pointer to the latest rebuilt index, if there is one
+	indexDir, err := currentIndexDir(indexPath)
+	if err != nil {
+		return nil, err
 	}
-	// Try to open existing index
-	index, err := bleve.Open(indexPath)
-	if err == bleve.ErrorIndexPathDoesNotExist {
-		// Create new index if not exists
-		indexMapping := buildIndexMapping()
-		index, err = bleve.New(indexPath, indexMapping)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create index: %v", err)
-		}
-
-		// Index data
-		log.Println("Indexing stocks...")
-		batch := index.NewBatch()
-		for _, stock := range stocks {
-			// Use Symbol as ID, but we might have duplicates across exchanges (e.g. RELIANCE on NSE and BSE)
-			// So we need a unique ID.
-			id := fmt.Sprintf("%s-%s", stock.Symbol, stock.Exchange)
-			if err := batch.Index(id, stock); err != nil {
-				return nil, fmt.Errorf("failed to add to batch: %v", err)
-			}
-		}
-		if err := index.Batch(batch); err != nil {
-			return nil, fmt.Errorf("failed to execute batch: %v", err)
-		}
-		log.Println("Indexing complete.")
-	} else if err != nil {
-		return nil, fmt.Errorf("failed to open index: %v", err)
-	} else {
-		log.Println("Opened existing index.")
+	index, err := openIndex(indexDir)
+	if err != nil {
+		return nil, err
+	}
+
+	engine := &BleveEngine{
+		semantic:  semantic,
+		indexPath: indexPath,
+		index:     index,
+		indexDir:  indexDir,
+		profiles:  map[string]RankingProfile{DefaultProfile: DefaultRankingProfile()},
+	}
+	return engine, nil
+}
+
+// SetRankingProfiles replaces the ranking profiles selectable per request. A
+// "default" profile is kept if profiles does not define one
+func (e *BleveEngine) SetRankingProfiles(profiles map[string]RankingProfile) {
+	merged := make(map[string]RankingProfile, len(profiles)+1)
+	merged[DefaultProfile] = DefaultRankingProfile()
+	for name, profile := range profiles {
+		merged[name] = profile
 	}
 
-	return &BleveEngine{
-		index:    index,
-		semantic: semantic,
-	}, nil
+	e.mu.Lock()
+	e.profiles = merged
+	e.mu.Unlock()
+}
+
+// rankingProfile looks up a profile by name. The caller must hold e.mu
+func (e *BleveEngine) rankingProfile(name string) (RankingProfile, error) {
+	profile, ok := e.profiles[name]
+	if !ok {
+		return RankingProfile{}, fmt.Errorf("%w: unknown ranking profile %q", ErrInvalidOptions, name)
+	}
+	return profile, nil
+}
+
+// lowercaseKeyword indexes a whole field value as a single lowercased term, used for sorting
+const lowercaseKeyword = "lowercase_keyword"
+
+// relevancePool is the minimum number of candidates re-ranked for relevance sorting, so that
+// the popularity blend can promote hits that Bleve alone ranked just outside the page
+const relevancePool = 200
+
+// maxPool caps the candidate pool grown to fill a page of grouped results
+const maxPool = MaxOffset + MaxLimit
+
+// facetSize is the maximum number of values returned per facet
+const facetSize = 20
+
+// stockFields are the stored fields needed to rebuild a models.Stock from a hit
+var stockFields = append([]string{
+	"symbol", "name", "exchange", "isin", "type", "brand", "sector", "industry", "tags", "popularity_score",
+	"series", "listing_date", "paid_up_value", "market_lot", "face_value",
+	"yahoo_symbol", "underlying", "fund_house", "scheme_category", "nav", "nav_date",
+	"status", "status_since", "status_reason", "aliases.alias", "aliases.kind", "aliases.effective",
+}, provenanceFields()...)
+
+// provenancePrefix prefixes the stored fields holding a stock's Provenance
+const provenancePrefix = "provenance."
+
+// provenanceFields are the stored provenance fields, one per stock field with a source
+func provenanceFields() []string {
+	var fields []string
+	for _, field := range []string{
+		"name", "isin", "type", "brand", "sector", "industry", "tags", "popularity_score",
+		"series", "listing_date", "paid_up_value", "market_lot", "face_value",
+		"yahoo_symbol", "underlying", "fund_house", "scheme_category", "nav", "nav_date",
+		"status", "status_since", "status_reason", "aliases",
+	} {
+		fields = append(fields, provenancePrefix+field)
+	}
+	return fields
 }
 
 func buildIndexMapping() mapping.IndexMapping {
 	// Create index mapping with custom field configurations
 	indexMapping := bleve.NewIndexMapping()
+	err := indexMapping.AddCustomAnalyzer(lowercaseKeyword, map[string]interface{}{
+		"type":          custom.Name,
+		"tokenizer":     single.Name,
+		"token_filters": []string{lowercase.Name},
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to register %s analyzer: %v", lowercaseKeyword, err)
+	}
 
 	// Create a stock mapping
 	stockMapping := bleve.NewDocumentMapping()
@@ -90,45 +174,314 @@ func buildIndexMapping() mapping.IndexMapping {
 	textFieldMapping := bleve.NewTextFieldMapping()
 	textFieldMapping.Store = true
 	textFieldMapping.Index = true
-	stockMapping.AddFieldMappingsAt("sector", textFieldMapping)
-	stockMapping.AddFieldMappingsAt("industry", textFieldMapping)
 	stockMapping.AddFieldMappingsAt("tags", textFieldMapping)
 
+	// ISINs are matched and grouped on as a whole
+	isinFieldMapping := bleve.NewKeywordFieldMapping()
+	isinFieldMapping.Store = true
+	isinFieldMapping.IncludeInAll = false
+	stockMapping.AddFieldMappingsAt("isin", isinFieldMapping)
+
+	// Listing dates (YYYY-MM-DD) are indexed as dates for range filters and sorting
+	listingDateMapping := bleve.NewDateTimeFieldMapping()
+	listingDateMapping.Store = true
+	listingDateMapping.IncludeInAll = false
+	stockMapping.AddFieldMappingsAt("listing_date", listingDateMapping)
+
+	// Remaining master data is only returned, not searched
+	storedNumberMapping := bleve.NewNumericFieldMapping()
+	storedNumberMapping.Store = true
+	storedNumberMapping.Index = false
+	storedNumberMapping.IncludeInAll = false
+	for _, field := range []string{"paid_up_value", "market_lot", "face_value", "nav"} {
+		stockMapping.AddFieldMappingsAt(field, storedNumberMapping)
+	}
+
+	// Filter fields keep their analyzed mapping for matching and gain an exact copy
+	// (exchange_facet, sector_facet, ...) for filtering and facet counts
+	for _, field := range FilterFields {
+		stockMapping.AddFieldMappingsAt(field, textFieldMapping, facetFieldMapping(field))
+	}
+
+	// Symbol and name keep their analyzed mapping for matching and gain an untokenized
+	// copy (symbol_sort, name_sort) so results can be ordered alphabetically
+	stockMapping.AddFieldMappingsAt("symbol", textFieldMapping, sortFieldMapping("symbol_sort"))
+	stockMapping.AddFieldMappingsAt("name", textFieldMapping, sortFieldMapping("name_sort"))
+
+	storedTextMapping := bleve.NewTextFieldMapping()
+	storedTextMapping.Store = true
+	storedTextMapping.Index = false
+	storedTextMapping.IncludeInAll = false
+	storedTextMapping.IncludeTermVectors = false
+
+	// Status details are only returned; the status itself is a filter field
+	stockMapping.AddFieldMappingsAt("status_since", storedTextMapping)
+	stockMapping.AddFieldMappingsAt("status_reason", storedTextMapping)
+
+	// So are the details of ETFs, indices and mutual fund schemes
+	for _, field := range []string{"yahoo_symbol", "underlying", "fund_house", "scheme_category", "nav_date"} {
+		stockMapping.AddFieldMappingsAt(field, storedTextMapping)
+	}
+
+	// Former symbols and names are matched like names, and looked up whole in a
+	// lowercased copy (aliases.alias_exact); their kind and date are only returned
+	aliasMapping := bleve.NewDocumentStaticMapping()
+	aliasMapping.AddFieldMappingsAt("alias", textFieldMapping, sortFieldMapping("alias_exact"))
+	aliasMapping.AddFieldMappingsAt("kind", storedTextMapping)
+	aliasMapping.AddFieldMappingsAt("effective", storedTextMapping)
+	stockMapping.AddSubDocumentMapping("aliases", aliasMapping)
+
+	// Provenance is kept for debugging only: stored, never searched
+	provenanceMapping := bleve.NewDocumentStaticMapping()
+	for _, field := range provenanceFields() {
+		provenanceMapping.AddFieldMappingsAt(strings.TrimPrefix(field, provenancePrefix), storedTextMapping)
+	}
+	stockMapping.AddSubDocumentMapping("provenance", provenanceMapping)
+
 	indexMapping.AddDocumentMapping("_default", stockMapping)
 
 	return indexMapping
 }
 
-func (e *BleveEngine) Search(query string) []models.Stock {
+// sortFieldMapping indexes a property under name as a single lowercased term
+func sortFieldMapping(name string) *mapping.FieldMapping {
+	fieldMapping := bleve.NewTextFieldMapping()
+	fieldMapping.Name = name
+	fieldMapping.Analyzer = lowercaseKeyword
+	fieldMapping.Store = false
+	fieldMapping.IncludeInAll = false
+	fieldMapping.IncludeTermVectors = false
+	return fieldMapping
+}
+
+// facetFieldMapping indexes a property as a single, case-preserving term under
+// <field>_facet so facet labels read exactly as the source data
+func facetFieldMapping(field string) *mapping.FieldMapping {
+	fieldMapping := bleve.NewKeywordFieldMapping()
+	fieldMapping.Name = facetField(field)
+	fieldMapping.Store = false
+	fieldMapping.IncludeInAll = false
+	fieldMapping.IncludeTermVectors = false
+	return fieldMapping
+}
+
+func facetField(field string) string {
+	return field + "_facet"
+}
+
+// newSearchRequest builds a request for q restricted by the filters in opts,
+// with the stored fields and facets every search path returns
+func newSearchRequest(q query.Query, size, from int, opts SearchOptions) *bleve.SearchRequest {
+	var filters []query.Query
+	for _, field := range FilterFields {
+		values := opts.Filters[field]
+		if len(values) == 0 {
+			continue
+		}
+		alternatives := bleve.NewDisjunctionQuery()
+		for _, value := range values {
+			termQuery := bleve.NewTermQuery(value)
+			termQuery.SetField(facetField(field))
+			alternatives.AddQuery(termQuery)
+		}
+		filters = append(filters, alternatives)
+	}
+
+	if opts.ListedAfter != "" || opts.ListedBefore != "" {
+		filters = append(filters, listingDateQuery(opts.ListedAfter, opts.ListedBefore))
+	}
+
+	if opts.excludesInactive() {
+		active := bleve.NewBooleanQuery()
+		active.AddMust(bleve.NewMatchAllQuery())
+		for _, status := range []string{models.StatusSuspended, models.StatusDelisted} {
+			termQuery := bleve.NewTermQuery(status)
+			termQuery.SetField(facetField("status"))
+			active.AddMustNot(termQuery)
+		}
+		filters = append(filters, active)
+	}
+
+	// Filters go through a boolean filter clause so they narrow the hits without
+	// contributing to the relevance score
+	if len(filters) > 0 {
+		filtered := bleve.NewBooleanQuery()
+		filtered.AddMust(q)
+		filtered.AddFilter(bleve.NewConjunctionQuery(filters...))
+		q = filtered
+	}
+
+	searchRequest := bleve.NewSearchRequestOptions(q, size, from, opts.Explain)
+	searchRequest.Fields = stockFields
+	for _, field := range FilterFields {
+		searchRequest.AddFacet(field, bleve.NewFacetRequest(facetField(field), facetSize))
+	}
+	return searchRequest
+}
+
+// listingDateQuery matches listing dates between after and before, both
+// inclusive YYYY-MM-DD dates validated by Normalize; an empty bound is open
+func listingDateQuery(after, before string) query.Query {
+	var start, end time.Time
+	if after != "" {
+		start, _ = time.Parse("2006-01-02", after)
+	}
+	if before != "" {
+		end, _ = time.Parse("2006-01-02", before)
+	}
+	inclusive := true
+	dateQuery := bleve.NewDateRangeInclusiveQuery(start, end, &inclusive, &inclusive)
+	dateQuery.SetField("listing_date")
+	return dateQuery
+}
+
+// facetCounts converts Bleve facet results into per-field value counts
+func facetCounts(searchResults *bleve.SearchResult) map[string][]FacetCount {
+	counts := make(map[string][]FacetCount)
+	for field, facet := range searchResults.Facets {
+		for _, term := range facet.Terms.Terms() {
+			// Stocks without a value index an empty term; they are not a facet choice
+			if term.Term == "" {
+				continue
+			}
+			counts[field] = append(counts[field], FacetCount{Value: term.Term, Count: term.Count})
+		}
+	}
+	return counts
+}
+
+// sortOrder maps a SearchOptions sort mode to a Bleve sort order
+func sortOrder(mode string) []string {
+	switch mode {
+	case SortPopularity:
+		return []string{"-popularity_score", "-_score"}
+	case SortSymbol:
+		return []string{"symbol_sort", "exchange"}
+	case SortName:
+		return []string{"name_sort", "symbol_sort"}
+	case SortListingDate:
+		return []string{"-listing_date", "symbol_sort"}
+	default:
+		return []string{"-_score"}
+	}
+}
+
+// stockFromFields rebuilds a stock from the stored fields of a hit
+func stockFromFields(fields map[string]interface{}) models.Stock {
+	getString := func(key string) string {
+		if val, ok := fields[key].(string); ok {
+			return val
+		}
+		return ""
+	}
+	getFloat := func(key string) float64 {
+		if val, ok := fields[key].(float64); ok {
+			return val
+		}
+		return 0.0
+	}
+	// Fields of a repeated sub-document hold a single value or a list
+	getStrings := func(key string) []string {
+		switch val := fields[key].(type) {
+		case string:
+			return []string{val}
+		case []interface{}:
+			values := make([]string, len(val))
+			for i, v := range val {
+				values[i], _ = v.(string)
+			}
+			return values
+		}
+		return nil
+	}
+
+	// Dates are stored as RFC 3339 timestamps; the date part is the original value
+	listingDate := getString("listing_date")
+	if len(listingDate) > len("2006-01-02") {
+		listingDate = listingDate[:len("2006-01-02")]
+	}
+
+	var aliases []models.SymbolAlias
+	kinds, effective := getStrings("aliases.kind"), getStrings("aliases.effective")
+	for i, alias := range getStrings("aliases.alias") {
+		if i < len(kinds) && i < len(effective) {
+			aliases = append(aliases, models.SymbolAlias{Alias: alias, Kind: kinds[i], Effective: effective[i]})
+		}
+	}
+
+	var provenance map[string]string
+	for _, field := range provenanceFields() {
+		if source := getString(field); source != "" {
+			if provenance == nil {
+				provenance = make(map[string]string)
+			}
+			provenance[strings.TrimPrefix(field, provenancePrefix)] = source
+		}
+	}
+
+	return models.Stock{
+		Symbol:          getString("symbol"),
+		Name:            getString("name"),
+		Exchange:        getString("exchange"),
+		ISIN:            getString("isin"),
+		Type:            getString("type"),
+		Brand:           getString("brand"),
+		Sector:          getString("sector"),
+		Industry:        getString("industry"),
+		Tags:            getString("tags"),
+		PopularityScore: getFloat("popularity_score"),
+		Series:          getString("series"),
+		ListingDate:     listingDate,
+		PaidUpValue:     getFloat("paid_up_value"),
+		MarketLot:       int(getFloat("market_lot")),
+		FaceValue:       getFloat("face_value"),
+		YahooSymbol:     getString("yahoo_symbol"),
+		Underlying:      getString("underlying"),
+		FundHouse:       getString("fund_house"),
+		SchemeCategory:  getString("scheme_category"),
+		NAV:             getFloat("nav"),
+		NAVDate:         getString("nav_date"),
+		Status:          getString("status"),
+		StatusSince:     getString("status_since"),
+		StatusReason:    getString("status_reason"),
+		Aliases:         aliases,
+		Provenance:      provenance,
+	}
+}
+
+func (e *BleveEngine) Search(query string, opts SearchOptions) (*SearchResult, error) {
+	opts, err := opts.Normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
 	// Check if this is a semantic query
 	if e.semantic != nil && e.semantic.IsSemanticQuery(query) {
-		return e.semanticSearch(query)
+		return e.semanticSearch(query, opts)
 	}
 
 	// Use regular search for non-semantic queries
-	return e.regularSearch(query)
+	return e.regularSearch(query, opts)
 }
 
 // semanticSearch handles natural language queries like "top broking stocks"
-func (e *BleveEngine) semanticSearch(query string) []models.Stock {
+func (e *BleveEngine) semanticSearch(query string, opts SearchOptions) (*SearchResult, error) {
 	// Extract sectors from the query
 	sectors := e.semantic.ExtractSectors(query)
 
 	if len(sectors) == 0 {
 		// No sectors found, fall back to regular search
-		return e.regularSearch(query)
+		return e.regularSearch(query, opts)
 	}
 
 	// Get stock symbols for the matched sectors
 	targetSymbols := e.semantic.GetStockSymbolsForSectors(sectors)
 
 	if len(targetSymbols) == 0 {
-		return []models.Stock{}
-	}
-
-	// Build queries for each symbol and combine them
-	if len(targetSymbols) == 0 {
-		return []models.Stock{}
+		return newSearchResult(0, opts, nil), nil
 	}
 
 	// Create first query
@@ -143,288 +496,501 @@ func (e *BleveEngine) semanticSearch(query string) []models.Stock {
 		searchQuery.AddQuery(termQuery)
 	}
 
-	searchRequest := bleve.NewSearchRequest(searchQuery)
-	searchRequest.Fields = []string{"symbol", "name", "exchange", "type", "brand", "sector", "industry", "tags", "popularity_score"}
-	searchRequest.Size = 100
-
-	searchResults, err := e.index.Search(searchRequest)
-	if err != nil {
-		log.Printf("Semantic search error: %v", err)
-		return []models.Stock{}
+	// For semantic search all results are equally relevant (from same sector),
+	// so relevance ordering means popularity ordering
+	sortMode := opts.Sort
+	if sortMode == SortRelevance {
+		sortMode = SortPopularity
 	}
 
-	// Helper functions
-	getString := func(fields map[string]interface{}, key string) string {
-		if val, ok := fields[key].(string); ok {
-			return val
-		}
-		return ""
+	// Ungrouped results are served by Bleve one page at a time; grouping merges
+	// listings, so a pool covering the page is fetched as for a regular search
+	size, offset := opts.Limit, opts.Offset
+	if opts.Group == GroupISIN {
+		size, offset = max(opts.Offset+opts.Limit, relevancePool), 0
 	}
 
-	getFloat := func(fields map[string]interface{}, key string) float64 {
-		if val, ok := fields[key].(float64); ok {
-			return val
+	for {
+		searchRequest := newSearchRequest(searchQuery, size, offset, opts)
+		searchRequest.SortBy(sortOrder(sortMode))
+
+		searchResults, err := e.index.Search(searchRequest)
+		if err != nil {
+			return nil, fmt.Errorf("semantic search failed: %v", err)
 		}
-		return 0.0
-	}
 
-	// Build results with scores
-	type ScoredStock struct {
-		Stock      models.Stock
-		FinalScore float64
-	}
+		var hits []Hit
+		for _, hit := range searchResults.Hits {
+			stock := stockFromFields(hit.Fields)
+			h := Hit{Stock: stock, Score: stock.PopularityScore, id: hit.ID}
+			if opts.Explain {
+				h.Explanation = &Explanation{
+					MatchedClauses:      []string{ClauseSemanticSector},
+					TextScore:           hit.Score,
+					PopularityScore:     stock.PopularityScore,
+					PopularityWeight:    1,
+					PopularityComponent: stock.PopularityScore,
+					FinalScore:          stock.PopularityScore,
+					Bleve:               hit.Expl,
+				}
+			}
+			hits = append(hits, h)
+		}
 
-	var scoredResults []ScoredStock
-	for _, hit := range searchResults.Hits {
-		popularityScore := getFloat(hit.Fields, "popularity_score")
-
-		stock := models.Stock{
-			Symbol:          getString(hit.Fields, "symbol"),
-			Name:            getString(hit.Fields, "name"),
-			Exchange:        getString(hit.Fields, "exchange"),
-			Type:            getString(hit.Fields, "type"),
-			Brand:           getString(hit.Fields, "brand"),
-			Sector:          getString(hit.Fields, "sector"),
-			Industry:        getString(hit.Fields, "industry"),
-			Tags:            getString(hit.Fields, "tags"),
-			PopularityScore: popularityScore,
-		}
-
-		// For semantic search, prioritize popularity score
-		// since all results are equally relevant (from same sector)
-		scoredResults = append(scoredResults, ScoredStock{
-			Stock:      stock,
-			FinalScore: popularityScore,
-		})
-	}
-
-	// Sort by popularity score (descending)
-	for i := 0; i < len(scoredResults); i++ {
-		for j := i + 1; j < len(scoredResults); j++ {
-			if scoredResults[j].FinalScore > scoredResults[i].FinalScore {
-				scoredResults[i], scoredResults[j] = scoredResults[j], scoredResults[i]
+		total := int(searchResults.Total)
+		if opts.Group == GroupISIN {
+			grouped, ok := groupPool(hits, total, opts, &size)
+			if !ok {
+				continue
 			}
+			total -= len(hits) - len(grouped)
+			hits = paginate(grouped, opts)
 		}
+
+		result := newSearchResult(total, opts, hits)
+		// Facets count the matching listings, also when hits are grouped
+		result.Facets = facetCounts(searchResults)
+		return result, nil
 	}
+}
 
-	// Extract just the stocks
-	var results []models.Stock
-	for _, scored := range scoredResults {
-		results = append(results, scored.Stock)
+// groupPool merges a candidate pool of hits by ISIN. It reports false, growing
+// poolSize, when grouping left too few hits to fill the requested page and a
+// larger pool is to be fetched
+func groupPool(hits []Hit, total int, opts SearchOptions, poolSize *int) ([]Hit, bool) {
+	grouped := groupHits(hits)
+	if len(hits) < total && len(grouped) <= opts.Offset+opts.Limit && *poolSize < maxPool {
+		*poolSize = min(*poolSize*2, maxPool)
+		return nil, false
 	}
+	return grouped, true
+}
 
-	return results
+// clause is one named sub-query of the regular search disjunction
+type clause struct {
+	name  string
+	query query.Query
 }
 
-// regularSearch is the original search logic extracted for reuse
-func (e *BleveEngine) regularSearch(query string) []models.Stock {
-	// Advanced search with match-type boosting and popularity ranking
+// buildClauses returns the sub-queries of a regular search, strongest match
+// first, boosted as configured in profile
+func buildClauses(input string, profile RankingProfile) []clause {
+	lower := strings.ToLower(input)
 
-	// 1. Exact Symbol Match (highest priority, boost = 10.0)
-	exactQuery := bleve.NewTermQuery(strings.ToLower(query))
+	// 1. Exact Symbol Match (highest priority, default boost = 10.0)
+	exactQuery := bleve.NewTermQuery(lower)
 	exactQuery.SetField("symbol")
-	exactQuery.SetBoost(10.0)
+	exactQuery.SetBoost(profile.boost(ClauseExactSymbol))
 
-	// 2. Prefix Symbol Match (high priority, boost = 5.0)
-	prefixQuery := bleve.NewPrefixQuery(strings.ToLower(query))
+	// 2. Exact ISIN Match (an ISIN identifies one company, default boost = 10.0)
+	isinQuery := bleve.NewTermQuery(strings.ToUpper(strings.TrimSpace(input)))
+	isinQuery.SetField("isin")
+	isinQuery.SetBoost(profile.boost(ClauseExactISIN))
+
+	// 3. Former symbol or name (e.g. TATAMOTORS for TMPV, default boost = 8.0)
+	aliasQuery := bleve.NewMatchQuery(input)
+	aliasQuery.SetField("aliases.alias")
+	aliasQuery.SetOperator(query.MatchQueryOperatorAnd)
+	aliasQuery.SetBoost(profile.boost(ClauseAlias))
+
+	// 4. Prefix Symbol Match (high priority, default boost = 5.0)
+	prefixQuery := bleve.NewPrefixQuery(lower)
 	prefixQuery.SetField("symbol")
-	prefixQuery.SetBoost(5.0)
+	prefixQuery.SetBoost(profile.boost(ClausePrefixSymbol))
 
-	// 3. Match Query on Name (medium priority, boost = 3.0)
-	nameMatchQuery := bleve.NewMatchQuery(query)
+	// 5. Match Query on Name (medium priority, default boost = 3.0)
+	nameMatchQuery := bleve.NewMatchQuery(input)
 	nameMatchQuery.SetField("name")
-	nameMatchQuery.SetBoost(3.0)
+	nameMatchQuery.SetBoost(profile.boost(ClauseNameMatch))
 
-	// 4. Wildcard Query for Symbol (fuzzy search, boost = 2.0)
-	wildcardSymbol := bleve.NewWildcardQuery("*" + strings.ToLower(query) + "*")
+	// 6. Wildcard Query for Symbol (substring search, default boost = 2.0)
+	wildcardSymbol := bleve.NewWildcardQuery("*" + lower + "*")
 	wildcardSymbol.SetField("symbol")
-	wildcardSymbol.SetBoost(2.0)
+	wildcardSymbol.SetBoost(profile.boost(ClauseWildcardSymbol))
 
-	// 5. Wildcard Query for Name (fuzzy search, boost = 1.5)
-	wildcardName := bleve.NewWildcardQuery("*" + strings.ToLower(query) + "*")
+	// 7. Wildcard Query for Name (substring search, default boost = 1.5)
+	wildcardName := bleve.NewWildcardQuery("*" + lower + "*")
 	wildcardName.SetField("name")
-	wildcardName.SetBoost(1.5)
+	wildcardName.SetBoost(profile.boost(ClauseWildcardName))
 
-	// 6. Wildcard Query for Brand (fuzzy search, boost = 1.0)
-	wildcardBrand := bleve.NewWildcardQuery("*" + strings.ToLower(query) + "*")
+	// 8. Wildcard Query for Brand (substring search, default boost = 1.0)
+	wildcardBrand := bleve.NewWildcardQuery("*" + lower + "*")
 	wildcardBrand.SetField("brand")
-	wildcardBrand.SetBoost(1.0)
+	wildcardBrand.SetBoost(profile.boost(ClauseWildcardBrand))
+
+	clauses := []clause{
+		{ClauseExactSymbol, exactQuery},
+		{ClauseExactISIN, isinQuery},
+		{ClauseAlias, aliasQuery},
+		{ClausePrefixSymbol, prefixQuery},
+		{ClauseNameMatch, nameMatchQuery},
+		{ClauseWildcardSymbol, wildcardSymbol},
+		{ClauseWildcardName, wildcardName},
+		{ClauseWildcardBrand, wildcardBrand},
+	}
 
-	// Combine all queries with Disjunction (OR)
-	searchQuery := bleve.NewDisjunctionQuery(
-		exactQuery,
-		prefixQuery,
-		nameMatchQuery,
-		wildcardSymbol,
-		wildcardName,
-		wildcardBrand,
-	)
-
-	searchRequest := bleve.NewSearchRequest(searchQuery)
-	searchRequest.Fields = []string{"symbol", "name", "exchange", "type", "brand", "sector", "industry", "tags", "popularity_score"}
-	searchRequest.Size = 100 // Get more results for better ranking
+	// 9. Fuzzy Query across symbol, name and brand (typo tolerance, default boost <= 1.2)
+	if fuzzyQuery := buildFuzzyQuery(input, profile); fuzzyQuery != nil {
+		clauses = append(clauses, clause{ClauseFuzzy, fuzzyQuery})
+	}
+	return clauses
+}
 
-	searchResults, err := e.index.Search(searchRequest)
+// regularSearch is the original search logic extracted for reuse
+func (e *BleveEngine) regularSearch(query string, opts SearchOptions) (*SearchResult, error) {
+	profile, err := e.rankingProfile(opts.Profile)
 	if err != nil {
-		log.Printf("Search error: %v", err)
-		return []models.Stock{}
+		return nil, err
 	}
 
-	// Helper to safely get string
-	getString := func(fields map[string]interface{}, key string) string {
-		if val, ok := fields[key].(string); ok {
-			return val
-		}
-		return ""
+	// Advanced search with match-type boosting and popularity ranking
+	clauses := buildClauses(query, profile)
+
+	// Combine all queries with Disjunction (OR)
+	searchQuery := bleve.NewDisjunctionQuery()
+	for _, c := range clauses {
+		searchQuery.AddQuery(c.query)
 	}
 
-	// Helper to safely get float64
-	getFloat := func(fields map[string]interface{}, key string) float64 {
-		if val, ok := fields[key].(float64); ok {
-			return val
+	// Explicit sort orders are served by Bleve directly, one page at a time
+	if opts.Sort != SortRelevance && opts.Group == GroupNone {
+		searchRequest := newSearchRequest(searchQuery, opts.Limit, opts.Offset, opts)
+		searchRequest.SortBy(sortOrder(opts.Sort))
+
+		searchResults, err := e.index.Search(searchRequest)
+		if err != nil {
+			return nil, fmt.Errorf("search failed: %v", err)
 		}
-		return 0.0
+
+		var hits []Hit
+		for _, hit := range searchResults.Hits {
+			hits = append(hits, sortedHit(hit, opts))
+		}
+		if opts.Explain {
+			e.explainClauses(hits, clauses)
+		}
+
+		result := newSearchResult(int(searchResults.Total), opts, hits)
+		result.Facets = facetCounts(searchResults)
+		return result, nil
 	}
 
-	// Build results with scores
-	type ScoredStock struct {
-		Stock      models.Stock
-		TextScore  float64
-		FinalScore float64
+	// Relevance blends in popularity after retrieval and grouping merges listings,
+	// so rank a candidate pool that covers the requested page and slice the page
+	// out afterwards. Grouping can shrink the pool below the page, in which case
+	// a larger pool is fetched
+	poolSize := opts.Offset + opts.Limit
+	if poolSize < relevancePool {
+		poolSize = relevancePool
 	}
 
-	var scoredResults []ScoredStock
-	for _, hit := range searchResults.Hits {
-		popularityScore := getFloat(hit.Fields, "popularity_score")
-
-		stock := models.Stock{
-			Symbol:          getString(hit.Fields, "symbol"),
-			Name:            getString(hit.Fields, "name"),
-			Exchange:        getString(hit.Fields, "exchange"),
-			Type:            getString(hit.Fields, "type"),
-			Brand:           getString(hit.Fields, "brand"),
-			Sector:          getString(hit.Fields, "sector"),
-			Industry:        getString(hit.Fields, "industry"),
-			Tags:            getString(hit.Fields, "tags"),
-			PopularityScore: popularityScore,
-		}
-
-		// Combine text relevance score (from Bleve) with popularity score
-		// Formula: final_score = (text_score * 0.7) + (popularity_score * 0.3)
-		// This ensures relevance is primary, but popularity provides a boost
-		textScore := hit.Score
-		finalScore := (textScore * 0.7) + (popularityScore * 0.3)
-
-		scoredResults = append(scoredResults, ScoredStock{
-			Stock:      stock,
-			TextScore:  textScore,
-			FinalScore: finalScore,
-		})
-	}
-
-	// Sort by final score (descending)
-	// Using a simple bubble sort for clarity (could use sort.Slice for production)
-	for i := 0; i < len(scoredResults); i++ {
-		for j := i + 1; j < len(scoredResults); j++ {
-			if scoredResults[j].FinalScore > scoredResults[i].FinalScore {
-				scoredResults[i], scoredResults[j] = scoredResults[j], scoredResults[i]
+	for {
+		searchRequest := newSearchRequest(searchQuery, poolSize, 0, opts)
+		if opts.Sort != SortRelevance {
+			searchRequest.SortBy(sortOrder(opts.Sort))
+		}
+
+		searchResults, err := e.index.Search(searchRequest)
+		if err != nil {
+			return nil, fmt.Errorf("search failed: %v", err)
+		}
+
+		var hits []Hit
+		for _, hit := range searchResults.Hits {
+			if opts.Sort == SortRelevance {
+				hits = append(hits, blendedHit(hit, opts, profile))
+			} else {
+				hits = append(hits, sortedHit(hit, opts))
 			}
 		}
+
+		if opts.Sort == SortRelevance {
+			// Sort by final score (descending)
+			sort.SliceStable(hits, func(i, j int) bool {
+				return hits[i].Score > hits[j].Score
+			})
+		}
+
+		total := int(searchResults.Total)
+		if opts.Group == GroupISIN {
+			grouped, ok := groupPool(hits, total, opts, &poolSize)
+			if !ok {
+				continue
+			}
+			// Hits beyond the pool are counted ungrouped, so the total is exact
+			// whenever the pool holds every hit and an upper bound otherwise
+			total -= len(hits) - len(grouped)
+			hits = grouped
+		}
+
+		page := paginate(hits, opts)
+		if opts.Explain {
+			e.explainClauses(page, clauses)
+		}
+
+		result := newSearchResult(total, opts, page)
+		if opts.Sort == SortRelevance {
+			result.Profile = opts.Profile
+		}
+		// Facets count the matching listings, also when hits are grouped
+		result.Facets = facetCounts(searchResults)
+		return result, nil
 	}
+}
 
-	// Extract just the stocks
-	var results []models.Stock
-	for _, scored := range scoredResults {
-		results = append(results, scored.Stock)
+// sortedHit converts a hit of an explicitly sorted search, scored by Bleve alone
+func sortedHit(hit *bsearch.DocumentMatch, opts SearchOptions) Hit {
+	h := Hit{Stock: stockFromFields(hit.Fields), Score: hit.Score, id: hit.ID}
+	if opts.Explain {
+		h.Explanation = &Explanation{
+			TextScore:       hit.Score,
+			PopularityScore: h.PopularityScore,
+			FinalScore:      hit.Score,
+			Bleve:           hit.Expl,
+		}
 	}
+	return h
+}
 
-	return results
+// blendedHit converts a hit of a relevance search, combining its text relevance
+// score (from Bleve) with its popularity score
+func blendedHit(hit *bsearch.DocumentMatch, opts SearchOptions, profile RankingProfile) Hit {
+	stock := stockFromFields(hit.Fields)
+
+	// Formula: final_score = (text_score * text_weight) + (normalized_popularity * popularity_weight)
+	// The default profile (0.7 / 0.3) keeps relevance primary, with popularity as a boost
+	textScore := hit.Score
+	popularity := profile.normalizePopularity(stock.PopularityScore)
+	finalScore := (textScore * profile.TextWeight) + (popularity * profile.PopularityWeight)
+
+	h := Hit{Stock: stock, Score: finalScore, id: hit.ID}
+	if opts.Explain {
+		h.Explanation = &Explanation{
+			TextScore:            textScore,
+			TextWeight:           profile.TextWeight,
+			TextComponent:        textScore * profile.TextWeight,
+			PopularityScore:      stock.PopularityScore,
+			NormalizedPopularity: popularity,
+			PopularityWeight:     profile.PopularityWeight,
+			PopularityComponent:  popularity * profile.PopularityWeight,
+			FinalScore:           finalScore,
+			Bleve:                hit.Expl,
+		}
+	}
+	return h
 }
 
-func (e *BleveEngine) GetBySymbol(symbol string) *models.Stock {
-	// Exact match on symbol (lowercase to match index)
-	termQuery := bleve.NewTermQuery(strings.ToLower(symbol))
-	termQuery.SetField("symbol")
+// explainClauses records which clauses each hit matched by re-running every
+// clause restricted to the hits' document IDs. It costs one query per clause,
+// so it only runs for the returned page and only in explain mode
+func (e *BleveEngine) explainClauses(hits []Hit, clauses []clause) {
+	if len(hits) == 0 {
+		return
+	}
 
-	searchRequest := bleve.NewSearchRequest(termQuery)
-	searchRequest.Fields = []string{"symbol", "name", "exchange", "type", "brand", "popularity_score"}
-	searchRequest.Size = 1 // Just get one
+	ids := make([]string, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.id
+		hits[i].Explanation.MatchedClauses = []string{}
+	}
 
-	searchResults, err := e.index.Search(searchRequest)
-	if err != nil || len(searchResults.Hits) == 0 {
+	for _, c := range clauses {
+		restricted := bleve.NewConjunctionQuery(bleve.NewDocIDQuery(ids), c.query)
+		searchRequest := bleve.NewSearchRequestOptions(restricted, len(ids), 0, false)
+
+		searchResults, err := e.index.Search(searchRequest)
+		if err != nil {
+			log.Printf("Explain error for clause %s: %v", c.name, err)
+			continue
+		}
+
+		matched := make(map[string]bool, len(searchResults.Hits))
+		for _, hit := range searchResults.Hits {
+			matched[hit.ID] = true
+		}
+		for i := range hits {
+			if matched[hits[i].id] {
+				hits[i].Explanation.MatchedClauses = append(hits[i].Explanation.MatchedClauses, c.name)
+			}
+		}
+	}
+}
+
+// fuzzyFields are the fields matched with edit-distance tolerance and the profile
+// boost key of each. Default boosts stay below the exact (10) and prefix (5)
+// symbol matches so typos never outrank them
+var fuzzyFields = []struct {
+	field    string
+	boostKey string
+}{
+	{"symbol", BoostFuzzySymbol},
+	{"name", BoostFuzzyName},
+	{"brand", BoostFuzzyBrand},
+}
+
+// buildFuzzyQuery matches misspelled queries such as "relaince" or "hdfc bnak".
+// Every whitespace-separated term must match symbol, name or brand within an
+// edit distance scaled by the term's length. Returns nil for an empty query
+func buildFuzzyQuery(input string, profile RankingProfile) query.Query {
+	terms := strings.Fields(strings.ToLower(input))
+	if len(terms) == 0 {
 		return nil
 	}
 
-	hit := searchResults.Hits[0]
-	getString := func(fields map[string]interface{}, key string) string {
-		if val, ok := fields[key].(string); ok {
-			return val
+	termQueries := make([]query.Query, 0, len(terms))
+	for _, term := range terms {
+		distance := fuzziness(term)
+		variants := transpositions(term)
+
+		termQuery := bleve.NewDisjunctionQuery()
+		for _, f := range fuzzyFields {
+			boost := profile.boost(f.boostKey)
+
+			fuzzy := bleve.NewFuzzyQuery(term)
+			fuzzy.SetField(f.field)
+			fuzzy.SetFuzziness(distance)
+			fuzzy.SetBoost(boost)
+			termQuery.AddQuery(fuzzy)
+
+			// An adjacent swap ("bnak") costs two edits, more than short terms are
+			// allowed, so match swapped spellings explicitly
+			for _, variant := range variants {
+				swapped := bleve.NewTermQuery(variant)
+				swapped.SetField(f.field)
+				swapped.SetBoost(boost)
+				termQuery.AddQuery(swapped)
+			}
 		}
-		return ""
+		termQueries = append(termQueries, termQuery)
 	}
 
-	getFloat := func(fields map[string]interface{}, key string) float64 {
-		if val, ok := fields[key].(float64); ok {
-			return val
+	if len(termQueries) == 1 {
+		return termQueries[0]
+	}
+	return bleve.NewConjunctionQuery(termQueries...)
+}
+
+// fuzziness returns the edit distance tolerated for a term: none for very short
+// terms, where any edit changes the meaning, up to Bleve's maximum of two
+func fuzziness(term string) int {
+	switch n := utf8.RuneCountInString(term); {
+	case n < 3:
+		return 0
+	case n < 6:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// transpositions returns the spellings of term with one pair of adjacent letters
+// swapped, for terms whose edit distance budget cannot absorb a swap
+func transpositions(term string) []string {
+	runes := []rune(term)
+	if len(runes) < 3 || fuzziness(term) > 1 {
+		return nil
+	}
+
+	var variants []string
+	for i := 0; i+1 < len(runes); i++ {
+		if runes[i] == runes[i+1] {
+			continue
 		}
-		return 0.0
+		swapped := append([]rune(nil), runes...)
+		swapped[i], swapped[i+1] = swapped[i+1], swapped[i]
+		variants = append(variants, string(swapped))
 	}
+	return variants
+}
 
-	return &models.Stock{
-		Symbol:          getString(hit.Fields, "symbol"),
-		Name:            getString(hit.Fields, "name"),
-		Exchange:        getString(hit.Fields, "exchange"),
-		Type:            getString(hit.Fields, "type"),
-		Brand:           getString(hit.Fields, "brand"),
-		PopularityScore: getFloat(hit.Fields, "popularity_score"),
+// Suggest returns autocomplete completions from the in-memory prefix index,
+// without touching Bleve, so it is cheap enough to call on every keystroke
+func (e *BleveEngine) Suggest(prefix string, limit int) []Suggestion {
+	e.mu.RLock()
+	suggester := e.suggester
+	e.mu.RUnlock()
+	if suggester == nil {
+		return []Suggestion{}
 	}
+	return suggester.Suggest(prefix, limit)
 }
 
+func (e *BleveEngine) GetBySymbol(symbol string) *models.Stock {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.getBySymbol(symbol)
+}
+
+func (e *BleveEngine) getBySymbol(symbol string) *models.Stock {
+	if stock := e.lookup("symbol", symbol, ""); stock != nil {
+		return stock
+	}
+	return e.lookup("aliases.alias_exact", symbol, "")
+}
+
+// GetStock looks up a listing by symbol and exchange, falling back to any
+// exchange. Former symbols resolve to the current listing with RenamedFrom set
 func (e *BleveEngine) GetStock(symbol, exchange string) *models.Stock {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
 	// If exchange is provided, search with Symbol AND Exchange
 	if exchange != "" {
-		symbolQuery := bleve.NewTermQuery(strings.ToLower(symbol))
-		symbolQuery.SetField("symbol")
+		if stock := e.lookup("symbol", symbol, exchange); stock != nil {
+			return stock
+		}
+		if stock := e.lookup("aliases.alias_exact", symbol, exchange); stock != nil {
+			return stock
+		}
+	}
 
+	// Fallback to GetBySymbol if exchange is empty or not found
+	return e.getBySymbol(symbol)
+}
+
+// lookup finds a listing whose symbol, or former symbol when field is
+// aliases.alias_exact, is symbol, optionally on exchange. The caller must hold e.mu
+func (e *BleveEngine) lookup(field, symbol, exchange string) *models.Stock {
+	// Exact match on symbol (lowercase to match index)
+	symbolQuery := bleve.NewTermQuery(strings.ToLower(symbol))
+	symbolQuery.SetField(field)
+
+	var q query.Query = symbolQuery
+	if exchange != "" {
 		exchangeQuery := bleve.NewTermQuery(strings.ToLower(exchange))
 		exchangeQuery.SetField("exchange")
+		q = bleve.NewConjunctionQuery(symbolQuery, exchangeQuery)
+	}
 
-		query := bleve.NewConjunctionQuery(symbolQuery, exchangeQuery)
+	searchRequest := bleve.NewSearchRequest(q)
+	searchRequest.Fields = stockFields
+	searchRequest.Size = 1 // Just get one
+	if field != "symbol" {
+		searchRequest.Size = 10 // former names can share the term, check each
+	}
 
-		searchRequest := bleve.NewSearchRequest(query)
-		searchRequest.Fields = []string{"symbol", "name", "exchange", "type", "brand", "popularity_score"}
-		searchRequest.Size = 1
+	searchResults, err := e.index.Search(searchRequest)
+	if err != nil {
+		return nil
+	}
 
-		searchResults, err := e.index.Search(searchRequest)
-		if err == nil && len(searchResults.Hits) > 0 {
-			hit := searchResults.Hits[0]
-			getString := func(fields map[string]interface{}, key string) string {
-				if val, ok := fields[key].(string); ok {
-					return val
-				}
-				return ""
-			}
-			getFloat := func(fields map[string]interface{}, key string) float64 {
-				if val, ok := fields[key].(float64); ok {
-					return val
-				}
-				return 0.0
-			}
-			return &models.Stock{
-				Symbol:          getString(hit.Fields, "symbol"),
-				Name:            getString(hit.Fields, "name"),
-				Exchange:        getString(hit.Fields, "exchange"),
-				Type:            getString(hit.Fields, "type"),
-				Brand:           getString(hit.Fields, "brand"),
-				PopularityScore: getFloat(hit.Fields, "popularity_score"),
+	for _, hit := range searchResults.Hits {
+		stock := stockFromFields(hit.Fields)
+		if field == "symbol" {
+			return &stock
+		}
+		for _, alias := range stock.Aliases {
+			if alias.Kind == models.AliasSymbol && strings.EqualFold(alias.Alias, symbol) {
+				stock.RenamedFrom = &alias
+				return &stock
 			}
 		}
 	}
-
-	// Fallback to GetBySymbol if exchange is empty or not found
-	return e.GetBySymbol(symbol)
+	return nil
 }
 
 func (e *BleveEngine) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
 	return e.index.Close()
 }
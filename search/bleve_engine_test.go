@@ -0,0 +1,378 @@
+package search
+
+import (
+	"errors"
+	"path/filepath"
+	"stock-search/models"
+	"testing"
+)
+
+func testStocks() []models.Stock {
+	return []models.Stock{
+		{Symbol: "RELIANCE", Name: "Reliance Industries Limited", Exchange: "NSE", Type: "Stock", Brand: "Jio", PopularityScore: 1.0},
+		{Symbol: "INFY", Name: "Infosys Limited", Exchange: "NSE", Type: "Stock", Brand: "Infosys, Finacle", PopularityScore: 0.95},
+		{Symbol: "HDFCBANK", Name: "HDFC Bank Limited", Exchange: "NSE", Type: "Stock", Brand: "HDFC, PayZapp", PopularityScore: 0.96},
+		{Symbol: "ICICIBANK", Name: "ICICI Bank Limited", Exchange: "NSE", Type: "Stock", Brand: "ICICI", PopularityScore: 0.94},
+		{Symbol: "AXISBANK", Name: "Axis Bank Limited", Exchange: "NSE", Type: "Stock", Brand: "Axis", PopularityScore: 0.82},
+		{Symbol: "TCS", Name: "Tata Consultancy Services Limited", Exchange: "NSE", Type: "Stock", Brand: "Tata", PopularityScore: 0.98},
+	}
+}
+
+func newTestEngine(t *testing.T, stocks []models.Stock) *BleveEngine {
+	t.Helper()
+	engine, err := NewBleveEngine(filepath.Join(t.TempDir(), "index.bleve"), stocks, filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil {
+		t.Fatalf("NewBleveEngine failed: %v", err)
+	}
+	t.Cleanup(func() { engine.Close() })
+	return engine
+}
+
+func mustSearch(t *testing.T, engine SearchEngine, query string, opts SearchOptions) *SearchResult {
+	t.Helper()
+	result, err := engine.Search(query, opts)
+	if err != nil {
+		t.Fatalf("Search(%q) failed: %v", query, err)
+	}
+	return result
+}
+
+func TestSearchPagination(t *testing.T) {
+	engine := newTestEngine(t, testStocks())
+
+	first := mustSearch(t, engine, "bank", SearchOptions{Limit: 2, Sort: SortSymbol})
+	if first.Total != 3 {
+		t.Fatalf("Expected 3 total hits, got %d", first.Total)
+	}
+	if len(first.Results) != 2 || first.Results[0].Symbol != "AXISBANK" {
+		t.Fatalf("Unexpected first page: %+v", first.Results)
+	}
+	if first.NextOffset == nil || *first.NextOffset != 2 {
+		t.Fatalf("Expected next offset 2, got %v", first.NextOffset)
+	}
+
+	second := mustSearch(t, engine, "bank", SearchOptions{Limit: 2, Offset: *first.NextOffset, Sort: SortSymbol})
+	if len(second.Results) != 1 || second.Results[0].Symbol != "ICICIBANK" {
+		t.Fatalf("Unexpected second page: %+v", second.Results)
+	}
+	if second.NextOffset != nil {
+		t.Errorf("Expected no next offset on last page, got %d", *second.NextOffset)
+	}
+
+	// A grouped total may only be an upper bound; a short page still ends paging
+	if result := newSearchResult(50, SearchOptions{Limit: 20, Offset: 40}, make([]Hit, 3)); result.NextOffset != nil {
+		t.Errorf("Expected no next offset after a short page, got %d", *result.NextOffset)
+	}
+}
+
+func TestSearchTypoTolerance(t *testing.T) {
+	engine := newTestEngine(t, testStocks())
+
+	tests := []struct {
+		query  string
+		symbol string
+	}{
+		{"relaince", "RELIANCE"},
+		{"infosis", "INFY"},
+		{"hdfc bnak", "HDFCBANK"},
+	}
+
+	for _, tt := range tests {
+		result := mustSearch(t, engine, tt.query, SearchOptions{})
+		if len(result.Results) == 0 {
+			t.Errorf("Search(%q) returned no results", tt.query)
+			continue
+		}
+		if got := result.Results[0].Symbol; got != tt.symbol {
+			t.Errorf("Search(%q) top result = %s, want %s", tt.query, got, tt.symbol)
+		}
+	}
+}
+
+func TestFuzziness(t *testing.T) {
+	tests := map[string]int{"lt": 0, "tcs": 1, "bnak": 1, "infosis": 2, "relaince": 2}
+	for term, want := range tests {
+		if got := fuzziness(term); got != want {
+			t.Errorf("fuzziness(%q) = %d, want %d", term, got, want)
+		}
+	}
+}
+
+func TestSearchFiltersAndFacets(t *testing.T) {
+	stocks := testStocks()
+	for i := range stocks {
+		if stocks[i].Symbol == "HDFCBANK" || stocks[i].Symbol == "ICICIBANK" || stocks[i].Symbol == "AXISBANK" {
+			stocks[i].Sector = "Banking"
+		}
+	}
+	stocks = append(stocks, models.Stock{Symbol: "500180", Name: "HDFC Bank Limited", Exchange: "BSE", Type: "Stock", Sector: "Banking"})
+	engine := newTestEngine(t, stocks)
+
+	result := mustSearch(t, engine, "bank", SearchOptions{Filters: map[string][]string{"exchange": {"BSE"}}})
+	if result.Total != 1 || result.Results[0].Symbol != "500180" {
+		t.Fatalf("Expected only the BSE listing, got %+v", result.Results)
+	}
+
+	result = mustSearch(t, engine, "limited", SearchOptions{})
+	counts := make(map[string]int)
+	for _, facet := range result.Facets["exchange"] {
+		counts[facet.Value] = facet.Count
+	}
+	if counts["NSE"] != 6 || counts["BSE"] != 1 {
+		t.Errorf("Unexpected exchange facets: %+v", result.Facets["exchange"])
+	}
+	if sectors := result.Facets["sector"]; len(sectors) != 1 || sectors[0].Value != "Banking" || sectors[0].Count != 4 {
+		t.Errorf("Unexpected sector facets: %+v", sectors)
+	}
+}
+
+func TestSearchExplain(t *testing.T) {
+	engine := newTestEngine(t, testStocks())
+
+	result := mustSearch(t, engine, "reliance", SearchOptions{Limit: 1, Explain: true})
+	if len(result.Results) != 1 {
+		t.Fatalf("Expected one result, got %d", len(result.Results))
+	}
+	hit := result.Results[0]
+	expl := hit.Explanation
+	if expl == nil {
+		t.Fatal("Expected an explanation with explain=true")
+	}
+
+	matched := make(map[string]bool)
+	for _, name := range expl.MatchedClauses {
+		matched[name] = true
+	}
+	for _, name := range []string{ClauseExactSymbol, ClausePrefixSymbol, ClauseNameMatch} {
+		if !matched[name] {
+			t.Errorf("Expected clause %s in %v", name, expl.MatchedClauses)
+		}
+	}
+	if matched[ClauseWildcardBrand] {
+		t.Errorf("Did not expect %s to match: %v", ClauseWildcardBrand, expl.MatchedClauses)
+	}
+
+	if expl.FinalScore != hit.Score || expl.TextComponent+expl.PopularityComponent != expl.FinalScore {
+		t.Errorf("Score breakdown does not add up: %+v (score %f)", expl, hit.Score)
+	}
+	if expl.Bleve == nil {
+		t.Error("Expected the raw Bleve explanation")
+	}
+
+	if plain := mustSearch(t, engine, "reliance", SearchOptions{Limit: 1}); plain.Results[0].Explanation != nil {
+		t.Error("Did not expect an explanation without explain=true")
+	}
+}
+
+func TestSearchGroupsByISIN(t *testing.T) {
+	stocks := testStocks()
+	stocks[0].ISIN = "INE002A01018"
+	stocks = append(stocks,
+		models.Stock{Symbol: "500325", Name: "RELIANCE INDUSTRIES LTD.", Exchange: "BSE", ISIN: "INE002A01018", PopularityScore: 1.0},
+		models.Stock{Symbol: "RELIANCE", Name: "Reliance Industries Limited", Exchange: "BSE", ISIN: "INE002A01018", PopularityScore: 1.0},
+	)
+	engine := newTestEngine(t, stocks)
+
+	result := mustSearch(t, engine, "reliance", SearchOptions{})
+	if result.Total != 1 || len(result.Results) != 1 {
+		t.Fatalf("Expected one grouped result, got %d: %+v", result.Total, result.Results)
+	}
+	hit := result.Results[0]
+	if hit.Symbol != "RELIANCE" || hit.Exchange != "NSE" {
+		t.Errorf("Expected the NSE listing to represent the group, got %s/%s", hit.Symbol, hit.Exchange)
+	}
+	if len(hit.Listings) != 2 || hit.Listings[0].Symbol != "RELIANCE" || hit.Listings[1].Symbol != "500325" {
+		t.Errorf("Unexpected listings: %+v", hit.Listings)
+	}
+
+	ungrouped := mustSearch(t, engine, "reliance", SearchOptions{Group: GroupNone, Sort: SortSymbol})
+	if ungrouped.Total != 3 || ungrouped.Results[0].Listings != nil {
+		t.Errorf("Expected three separate listings with group=none, got %+v", ungrouped.Results)
+	}
+
+	// A group shown by its NSE listing explains that listing's document
+	grouped := groupHits([]Hit{
+		{Stock: models.Stock{Symbol: "500325", Exchange: "BSE", ISIN: "INE002A01018"}, id: "500325_BSE"},
+		{Stock: models.Stock{Symbol: "RELIANCE", Exchange: "NSE", ISIN: "INE002A01018"}, id: "RELIANCE_NSE"},
+	})
+	if len(grouped) != 1 || grouped[0].Symbol != "RELIANCE" || grouped[0].id != "RELIANCE_NSE" {
+		t.Errorf("Expected the NSE listing and its document ID, got %+v", grouped)
+	}
+}
+
+func TestSearchMasterData(t *testing.T) {
+	stocks := testStocks()
+	for i := range stocks {
+		stocks[i].Series = "EQ"
+	}
+	stocks[0].ISIN = "INE002A01018"
+	stocks[0].ListingDate = "1995-11-29"
+	stocks[1].ListingDate = "1995-06-08"
+	stocks[2].ListingDate = "2024-03-01"
+	stocks[3].Series = "BE"
+	stocks[3].ListingDate = "2023-07-15"
+	engine := newTestEngine(t, stocks)
+
+	if result := mustSearch(t, engine, "ine002a01018", SearchOptions{}); result.Total != 1 || result.Results[0].Symbol != "RELIANCE" {
+		t.Errorf("Expected an ISIN search to find RELIANCE, got %+v", result.Results)
+	}
+
+	result := mustSearch(t, engine, "bank", SearchOptions{Filters: map[string][]string{"series": {"BE"}}})
+	if result.Total != 1 || result.Results[0].Symbol != "ICICIBANK" {
+		t.Errorf("Expected only the BE series listing, got %+v", result.Results)
+	}
+
+	result = mustSearch(t, engine, "limited", SearchOptions{ListedAfter: "2023", Sort: SortListingDate})
+	if result.Total != 2 || result.Results[0].Symbol != "HDFCBANK" || result.Results[1].Symbol != "ICICIBANK" {
+		t.Errorf("Expected listings since 2023, newest first, got %+v", result.Results)
+	}
+	if date := result.Results[0].ListingDate; date != "2024-03-01" {
+		t.Errorf("Expected listing date 2024-03-01, got %q", date)
+	}
+
+	result = mustSearch(t, engine, "limited", SearchOptions{ListedBefore: "1995-07-01"})
+	if result.Total != 1 || result.Results[0].Symbol != "INFY" {
+		t.Errorf("Expected only INFY listed before July 1995, got %+v", result.Results)
+	}
+
+	if _, err := engine.Search("limited", SearchOptions{ListedAfter: "last year"}); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("Expected ErrInvalidOptions for a malformed date, got %v", err)
+	}
+}
+
+func TestSearchProvenance(t *testing.T) {
+	stocks := testStocks()
+	stocks[0].Provenance = map[string]string{"name": "nse_equity", "brand": "curated+brands"}
+	engine := newTestEngine(t, stocks)
+
+	stock := engine.GetBySymbol("RELIANCE")
+	if stock == nil || stock.Provenance["name"] != "nse_equity" || stock.Provenance["brand"] != "curated+brands" {
+		t.Fatalf("Expected the provenance to be stored, got %+v", stock)
+	}
+
+	// Source names are stored for debugging, not searchable
+	if result := mustSearch(t, engine, "nse_equity", SearchOptions{}); result.Total != 0 {
+		t.Errorf("Expected provenance not to be searchable, got %+v", result.Results)
+	}
+}
+
+func TestSymbolAliases(t *testing.T) {
+	stocks := append(testStocks(),
+		models.Stock{Symbol: "TMPV", Name: "Tata Motors Passenger Vehicles Limited", Exchange: "NSE", PopularityScore: 0.8,
+			Aliases: []models.SymbolAlias{{Alias: "TATAMOTORS", Kind: models.AliasSymbol, Effective: "2025-10-14"}}},
+		models.Stock{Symbol: "ETERNAL", Name: "Eternal Limited", Exchange: "NSE", PopularityScore: 0.8,
+			Aliases: []models.SymbolAlias{
+				{Alias: "Zomato Limited", Kind: models.AliasName, Effective: "2025-03-20"},
+				{Alias: "ZOMATO", Kind: models.AliasSymbol, Effective: "2025-04-09"},
+			}},
+		models.Stock{Symbol: "UNITDSPR", Name: "United Spirits Limited", Exchange: "NSE", PopularityScore: 0.7,
+			Aliases: []models.SymbolAlias{{Alias: "MCDOWELL-N", Kind: models.AliasSymbol, Effective: "2023-05-22"}}},
+	)
+	engine := newTestEngine(t, stocks)
+
+	stock := engine.GetBySymbol("tatamotors")
+	if stock == nil || stock.Symbol != "TMPV" {
+		t.Fatalf("Expected TATAMOTORS to resolve to TMPV, got %+v", stock)
+	}
+	if stock.RenamedFrom == nil || stock.RenamedFrom.Alias != "TATAMOTORS" || stock.RenamedFrom.Effective != "2025-10-14" {
+		t.Errorf("Expected a renamedFrom hint, got %+v", stock.RenamedFrom)
+	}
+
+	stock = engine.GetStock("ZOMATO", "NSE")
+	if stock == nil || stock.Symbol != "ETERNAL" || stock.RenamedFrom == nil || len(stock.Aliases) != 2 {
+		t.Fatalf("Expected ZOMATO on NSE to resolve to ETERNAL, got %+v", stock)
+	}
+	if stock := engine.GetBySymbol("TMPV"); stock == nil || stock.RenamedFrom != nil {
+		t.Errorf("Expected no renamedFrom hint for a current symbol, got %+v", stock)
+	}
+	// Former symbols are looked up whole, not by the words the analyzer splits them into
+	if stock := engine.GetStock("MCDOWELL-N", "NSE"); stock == nil || stock.Symbol != "UNITDSPR" {
+		t.Errorf("Expected MCDOWELL-N to resolve to UNITDSPR, got %+v", stock)
+	}
+	if stock := engine.GetBySymbol("zomato limited"); stock != nil {
+		t.Errorf("Expected former names not to resolve as symbols, got %+v", stock)
+	}
+
+	result := mustSearch(t, engine, "zomato", SearchOptions{Explain: true})
+	if result.Total == 0 || result.Results[0].Symbol != "ETERNAL" {
+		t.Fatalf("Expected a search for the former name to find ETERNAL, got %+v", result.Results)
+	}
+	if clauses := result.Results[0].Explanation.MatchedClauses; len(clauses) == 0 || clauses[0] != ClauseAlias {
+		t.Errorf("Expected the %s clause to match, got %v", ClauseAlias, clauses)
+	}
+}
+
+func TestListingStatusFilter(t *testing.T) {
+	stocks := append(testStocks(),
+		models.Stock{Symbol: "HDFC", Name: "Housing Development Finance Corporation Limited", Exchange: "NSE", PopularityScore: 0.9,
+			Status: models.StatusDelisted, StatusSince: "2023-07-13", StatusReason: "Merged into HDFC Bank"},
+		models.Stock{Symbol: "FEL", Name: "Future Enterprises Limited", Exchange: "NSE", Status: models.StatusSuspended},
+		models.Stock{Symbol: "SMALLCO", Name: "Small Enterprises Limited", Exchange: "NSE", Series: "BE", Status: models.StatusTradeToTrade},
+	)
+	engine := newTestEngine(t, stocks)
+
+	result := mustSearch(t, engine, "limited", SearchOptions{})
+	if result.Total != 7 {
+		t.Errorf("Expected suspended and delisted listings to be left out, got %d hits", result.Total)
+	}
+	for _, stock := range result.Results {
+		if stock.Symbol == "HDFC" || stock.Symbol == "FEL" {
+			t.Errorf("Unexpected inactive listing %s", stock.Symbol)
+		}
+	}
+
+	result = mustSearch(t, engine, "limited", SearchOptions{IncludeInactive: true})
+	if result.Total != 9 {
+		t.Errorf("Expected every listing with include inactive, got %d hits", result.Total)
+	}
+	counts := make(map[string]int)
+	for _, facet := range result.Facets["status"] {
+		counts[facet.Value] = facet.Count
+	}
+	if counts[models.StatusActive] != 6 || counts[models.StatusDelisted] != 1 || counts[models.StatusTradeToTrade] != 1 {
+		t.Errorf("Unexpected status facets: %+v", result.Facets["status"])
+	}
+
+	result = mustSearch(t, engine, "enterprises", SearchOptions{Filters: map[string][]string{"status": {models.StatusSuspended}}})
+	if result.Total != 1 || result.Results[0].Symbol != "FEL" {
+		t.Fatalf("Expected the status filter to find the suspended listing, got %+v", result.Results)
+	}
+
+	if stock := engine.GetBySymbol("HDFC"); stock == nil || stock.StatusReason != "Merged into HDFC Bank" || stock.StatusSince != "2023-07-13" {
+		t.Errorf("Expected delisted listings to stay reachable by symbol, got %+v", stock)
+	}
+	for _, suggestion := range engine.Suggest("fe", 5) {
+		if suggestion.Symbol == "FEL" {
+			t.Errorf("Expected no suggestion for a suspended listing, got %+v", suggestion)
+		}
+	}
+}
+
+func TestInstrumentTypes(t *testing.T) {
+	stocks := append(testStocks(),
+		models.Stock{Symbol: "NIFTYBEES", Name: "Nippon India ETF Nifty 50 BeES", Exchange: "NSE", Type: models.TypeETF, Underlying: "Nifty 50 Index"},
+		models.Stock{Symbol: "BANKNIFTY", Name: "NIFTY BANK", Exchange: "NSE", Type: models.TypeIndex, Sector: "Banking", YahooSymbol: "^NSEBANK"},
+		models.Stock{Symbol: "120716", Name: "UTI Nifty 50 Index Fund - Growth Option- Direct", Exchange: models.ExchangeAMFI,
+			Type: models.TypeMutualFund, FundHouse: "UTI Mutual Fund", SchemeCategory: "Other Scheme - Index Funds", NAV: 176.4129, NAVDate: "2025-10-14"},
+	)
+	engine := newTestEngine(t, stocks)
+
+	result := mustSearch(t, engine, "nifty", SearchOptions{Filters: map[string][]string{"type": {models.TypeIndex}}})
+	if result.Total != 1 || result.Results[0].Symbol != "BANKNIFTY" || result.Results[0].YahooSymbol != "^NSEBANK" {
+		t.Fatalf("Expected only the index, got %+v", result.Results)
+	}
+
+	result = mustSearch(t, engine, "nifty", SearchOptions{})
+	counts := make(map[string]int)
+	for _, facet := range result.Facets["type"] {
+		counts[facet.Value] = facet.Count
+	}
+	if counts[models.TypeETF] != 1 || counts[models.TypeIndex] != 1 || counts[models.TypeMutualFund] != 1 {
+		t.Errorf("Unexpected type facets: %+v", result.Facets["type"])
+	}
+
+	fund := engine.GetStock("120716", models.ExchangeAMFI)
+	if fund == nil || fund.FundHouse != "UTI Mutual Fund" || fund.NAV != 176.4129 || fund.NAVDate != "2025-10-14" {
+		t.Errorf("Expected the scheme details to be stored, got %+v", fund)
+	}
+}
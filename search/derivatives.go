@@ -0,0 +1,246 @@
+package search
+
+import (
+	"sort"
+	"stock-search/models"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// DerivativeQuery is a shorthand contract search such as "NIFTY 24500 CE" or
+// "RELIANCE FUT DEC". Zero fields match any contract
+type DerivativeQuery struct {
+	Underlying string     // e.g. NIFTY, or BANK NIFTY as typed
+	Future     bool       // futures only
+	OptionType string     // models.OptionCall or models.OptionPut: options of that type only
+	Strike     float64    // options at this strike only
+	Month      time.Month // expiring in this month
+	Day        int        // expiring on this day of the month
+	Year       int
+}
+
+// Words of the derivative shorthand
+var (
+	futureWords = map[string]bool{"FUT": true, "FUTS": true, "FUTURE": true, "FUTURES": true}
+	optionWords = map[string]string{
+		"CE": models.OptionCall, "CALL": models.OptionCall, "CALLS": models.OptionCall,
+		"PE": models.OptionPut, "PUT": models.OptionPut, "PUTS": models.OptionPut,
+	}
+)
+
+// parseMonth reads JAN to DEC or a full month name
+func parseMonth(word string) (time.Month, bool) {
+	for m := time.January; m <= time.December; m++ {
+		name := strings.ToUpper(m.String())
+		if word == name || word == name[:3] {
+			return m, true
+		}
+	}
+	return 0, false
+}
+
+// isDerivativeWord reports whether a word has a meaning in the shorthand
+func isDerivativeWord(word string) bool {
+	if _, err := strconv.ParseFloat(word, 64); err == nil {
+		return true
+	}
+	_, option := optionWords[word]
+	_, month := parseMonth(word)
+	return futureWords[word] || option || month
+}
+
+// splitDerivativeWord splits words such as 24500CE or 26DEC where letters meet
+// digits, as long as every part has a meaning in the shorthand
+func splitDerivativeWord(word string) []string {
+	var parts []string
+	start := 0
+	for i := 1; i < len(word); i++ {
+		if unicode.IsDigit(rune(word[i])) != unicode.IsDigit(rune(word[i-1])) && word[i] != '.' && word[i-1] != '.' {
+			parts = append(parts, word[start:i])
+			start = i
+		}
+	}
+	parts = append(parts, word[start:])
+	if len(parts) == 1 {
+		return parts
+	}
+	for _, part := range parts {
+		if !isDerivativeWord(part) {
+			return []string{word}
+		}
+	}
+	return parts
+}
+
+// ParseDerivativeQuery reads the derivative shorthand: an underlying followed,
+// in any order, by FUT or an option type (CE, PE, CALL, PUT), a strike and an
+// expiry month with an optional day before it and year after it. Words such as
+// FUTURE or CALL also occur in company names ("Future Enterprises"), so a query
+// is only a derivative query with an expiry month, a strike next to its option
+// type, or FUT as its last word
+func ParseDerivativeQuery(query string) (DerivativeQuery, bool) {
+	var words []string
+	for _, field := range strings.Fields(strings.ToUpper(query)) {
+		words = append(words, splitDerivativeWord(field)...)
+	}
+
+	var q DerivativeQuery
+	var underlying []string
+	var numbers []int // positions of the numeric words
+	monthAt, strikeAt := -1, -1
+	optionAt := make(map[int]bool)
+	for i, word := range words {
+		if futureWords[word] {
+			q.Future = true
+		} else if option, ok := optionWords[word]; ok {
+			if q.OptionType != "" && q.OptionType != option {
+				return q, false
+			}
+			q.OptionType = option
+			optionAt[i] = true
+		} else if month, ok := parseMonth(word); ok && monthAt < 0 {
+			q.Month, monthAt = month, i
+		} else if _, err := strconv.ParseFloat(word, 64); err == nil {
+			numbers = append(numbers, i)
+		} else {
+			underlying = append(underlying, word)
+		}
+	}
+	if len(underlying) == 0 || (!q.Future && q.OptionType == "") || (q.Future && q.OptionType != "") {
+		return q, false
+	}
+	q.Underlying = strings.Join(underlying, " ")
+
+	// A day just before the month and a year just after it; any other number is the strike
+	for _, i := range numbers {
+		value, _ := strconv.ParseFloat(words[i], 64)
+		switch {
+		case monthAt >= 0 && i == monthAt-1 && value >= 1 && value <= 31 && value == float64(int(value)):
+			q.Day = int(value)
+		case monthAt >= 0 && i == monthAt+1 && len(words[i]) == 4 && strings.HasPrefix(words[i], "20"):
+			q.Year = int(value)
+		case q.Strike == 0 && !q.Future:
+			q.Strike, strikeAt = value, i
+		default:
+			return q, false
+		}
+	}
+
+	strikeNextToOption := strikeAt >= 0 && (optionAt[strikeAt-1] || optionAt[strikeAt+1])
+	last := words[len(words)-1]
+	if monthAt < 0 && !strikeNextToOption && last != "FUT" && last != "FUTS" {
+		return q, false
+	}
+	return q, true
+}
+
+// matches reports whether a contract satisfies the query, apart from its underlying
+func (q DerivativeQuery) matches(contract models.Contract) bool {
+	if q.Future && !contract.IsFuture() {
+		return false
+	}
+	if q.OptionType != "" && contract.OptionType != q.OptionType {
+		return false
+	}
+	if q.Strike != 0 && contract.Strike != q.Strike {
+		return false
+	}
+	if q.Month != 0 || q.Day != 0 || q.Year != 0 {
+		expiry, err := time.Parse("2006-01-02", contract.Expiry)
+		if err != nil {
+			return false
+		}
+		if (q.Month != 0 && expiry.Month() != q.Month) || (q.Day != 0 && expiry.Day() != q.Day) || (q.Year != 0 && expiry.Year() != q.Year) {
+			return false
+		}
+	}
+	return true
+}
+
+// DerivativeGroup is the contracts of one underlying matching a derivative query
+type DerivativeGroup struct {
+	Underlying string            `json:"underlying"`
+	Listing    *models.Stock     `json:"listing,omitempty"` // the underlying stock or index, if indexed
+	Contracts  []models.Contract `json:"contracts"`
+}
+
+// ContractIndex finds futures and options contracts by underlying. It is safe
+// for concurrent use and can be updated while being read
+type ContractIndex struct {
+	mu           sync.RWMutex
+	byUnderlying map[string][]models.Contract // sorted by expiry, futures first, then strike and option type
+
+	now func() time.Time // for expiring contracts; replaced in tests
+}
+
+func NewContractIndex() *ContractIndex {
+	return &ContractIndex{byUnderlying: make(map[string][]models.Contract), now: time.Now}
+}
+
+// Update replaces the indexed contracts and returns the number of underlyings
+func (c *ContractIndex) Update(contracts []models.Contract) int {
+	byUnderlying := make(map[string][]models.Contract)
+	for _, contract := range contracts {
+		key := strings.ToUpper(contract.Underlying)
+		byUnderlying[key] = append(byUnderlying[key], contract)
+	}
+	for _, list := range byUnderlying {
+		sort.SliceStable(list, func(i, j int) bool {
+			a, b := list[i], list[j]
+			if a.Expiry != b.Expiry {
+				return a.Expiry < b.Expiry
+			}
+			if a.IsFuture() != b.IsFuture() {
+				return a.IsFuture()
+			}
+			if a.Strike != b.Strike {
+				return a.Strike < b.Strike
+			}
+			return a.OptionType < b.OptionType // CE before PE
+		})
+	}
+
+	c.mu.Lock()
+	c.byUnderlying = byUnderlying
+	c.mu.Unlock()
+	return len(byUnderlying)
+}
+
+// Search returns up to limit unexpired contracts matching q, nearest expiry
+// first. The underlying is matched as typed or with its spaces removed, so
+// "BANK NIFTY" finds BANKNIFTY
+func (c *ContractIndex) Search(q DerivativeQuery, limit int) []DerivativeGroup {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	today := c.now().Format("2006-01-02")
+	var groups []DerivativeGroup
+	seen := make(map[string]bool)
+	for _, underlying := range []string{q.Underlying, strings.ReplaceAll(q.Underlying, " ", "")} {
+		if seen[underlying] {
+			continue
+		}
+		seen[underlying] = true
+
+		group := DerivativeGroup{Underlying: underlying}
+		for _, contract := range c.byUnderlying[underlying] {
+			if limit > 0 && len(group.Contracts) == limit {
+				break
+			}
+			if contract.Expiry >= today && q.matches(contract) {
+				group.Contracts = append(group.Contracts, contract)
+			}
+		}
+		if len(group.Contracts) > 0 {
+			groups = append(groups, group)
+			limit -= len(group.Contracts)
+			if limit == 0 {
+				break
+			}
+		}
+	}
+	return groups
+}
@@ -0,0 +1,88 @@
+package search
+
+import (
+	"stock-search/models"
+	"testing"
+	"time"
+)
+
+func TestParseDerivativeQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		ok    bool
+		want  DerivativeQuery
+	}{
+		{"NIFTY 24500 CE", true, DerivativeQuery{Underlying: "NIFTY", OptionType: models.OptionCall, Strike: 24500}},
+		{"nifty 24500ce", true, DerivativeQuery{Underlying: "NIFTY", OptionType: models.OptionCall, Strike: 24500}},
+		{"RELIANCE FUT DEC", true, DerivativeQuery{Underlying: "RELIANCE", Future: true, Month: time.December}},
+		{"banknifty put 26 jun 2025 52000", true, DerivativeQuery{Underlying: "BANKNIFTY", OptionType: models.OptionPut, Strike: 52000, Month: time.June, Day: 26, Year: 2025}},
+		{"BANK NIFTY CALL JUN", true, DerivativeQuery{Underlying: "BANK NIFTY", OptionType: models.OptionCall, Month: time.June}},
+		{"RELIANCE FUT", true, DerivativeQuery{Underlying: "RELIANCE", Future: true}},
+		{"M&M 26DEC FUT", true, DerivativeQuery{Underlying: "M&M", Future: true, Month: time.December, Day: 26}},
+		{"RELIANCE", false, DerivativeQuery{}},
+		{"NIFTY 24500", false, DerivativeQuery{}},
+		{"CE 24500", false, DerivativeQuery{}},
+		{"RELIANCE FUT 2500", false, DerivativeQuery{}},
+		{"NIFTY CE PE", false, DerivativeQuery{}},
+		{"NIFTY FUT CE", false, DerivativeQuery{}},
+		// Company names with derivative words
+		{"Future Enterprises", false, DerivativeQuery{}},
+		{"future lifestyle", false, DerivativeQuery{}},
+		{"quadrant future tek", false, DerivativeQuery{}},
+		{"Quadrant Future", false, DerivativeQuery{}},
+		{"Call Options Capital", false, DerivativeQuery{}},
+		{"BANK NIFTY CALL", false, DerivativeQuery{}},
+	}
+	for _, tt := range tests {
+		got, ok := ParseDerivativeQuery(tt.query)
+		if ok != tt.ok || (ok && got != tt.want) {
+			t.Errorf("ParseDerivativeQuery(%q) = %+v, %v; want %+v, %v", tt.query, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestContractIndexSearch(t *testing.T) {
+	index := NewContractIndex()
+	index.now = func() time.Time { return time.Date(2025, time.June, 20, 10, 0, 0, 0, time.UTC) }
+	n := index.Update([]models.Contract{
+		{Symbol: "NIFTY31JUL2524500CE", Underlying: "NIFTY", Expiry: "2025-07-31", Strike: 24500, OptionType: models.OptionCall},
+		{Symbol: "NIFTY26JUN2524500PE", Underlying: "NIFTY", Expiry: "2025-06-26", Strike: 24500, OptionType: models.OptionPut},
+		{Symbol: "NIFTY26JUN2524500CE", Underlying: "NIFTY", Expiry: "2025-06-26", Strike: 24500, OptionType: models.OptionCall},
+		{Symbol: "NIFTY12JUN2524500CE", Underlying: "NIFTY", Expiry: "2025-06-12", Strike: 24500, OptionType: models.OptionCall},
+		{Symbol: "NIFTY26JUN25FUT", Underlying: "NIFTY", Expiry: "2025-06-26"},
+		{Symbol: "BANKNIFTY26JUN25FUT", Underlying: "BANKNIFTY", Expiry: "2025-06-26"},
+		{Symbol: "RELIANCE25DEC25FUT", Underlying: "RELIANCE", Expiry: "2025-12-25"},
+		{Symbol: "RELIANCE31JUL25FUT", Underlying: "RELIANCE", Expiry: "2025-07-31"},
+	})
+	if n != 3 {
+		t.Errorf("Expected 3 underlyings, got %d", n)
+	}
+
+	query, _ := ParseDerivativeQuery("NIFTY 24500 CE")
+	groups := index.Search(query, 10)
+	if len(groups) != 1 || groups[0].Underlying != "NIFTY" || len(groups[0].Contracts) != 2 {
+		t.Fatalf("Expected the 2 unexpired NIFTY 24500 calls, got %+v", groups)
+	}
+	if groups[0].Contracts[0].Symbol != "NIFTY26JUN2524500CE" {
+		t.Errorf("Expected the nearest expiry first, got %+v", groups[0].Contracts)
+	}
+	if groups := index.Search(query, 1); len(groups[0].Contracts) != 1 {
+		t.Errorf("Expected the limit to apply, got %+v", groups)
+	}
+
+	query, _ = ParseDerivativeQuery("RELIANCE FUT DEC")
+	if groups := index.Search(query, 10); len(groups) != 1 || len(groups[0].Contracts) != 1 || groups[0].Contracts[0].Symbol != "RELIANCE25DEC25FUT" {
+		t.Errorf("Expected the December future, got %+v", groups)
+	}
+
+	query, _ = ParseDerivativeQuery("bank nifty fut")
+	if groups := index.Search(query, 10); len(groups) != 1 || groups[0].Underlying != "BANKNIFTY" {
+		t.Errorf("Expected BANK NIFTY to find BANKNIFTY, got %+v", groups)
+	}
+
+	query, _ = ParseDerivativeQuery("NIFTY 24500 PE")
+	query.Month = time.July
+	if groups := index.Search(query, 10); len(groups) != 0 {
+		t.Errorf("Expected no contracts, got %+v", groups)
+	}
+}
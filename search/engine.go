@@ -1,34 +1,397 @@
 package search
 
 import (
+	"errors"
+	"fmt"
+	"sort"
 	"stock-search/models"
 	"strings"
+	"time"
 )
 
+// Supported values for SearchOptions.Sort
+const (
+	SortRelevance   = "relevance"
+	SortPopularity  = "popularity"
+	SortSymbol      = "symbol"
+	SortName        = "name"
+	SortListingDate = "listing_date" // most recently listed first
+)
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+	MaxOffset    = 10000
+)
+
+// FilterFields are the stock fields that can be filtered on and are returned as facets
+var FilterFields = []string{"exchange", "sector", "industry", "type", "series", "status"}
+
 type SearchEngine interface {
-	Search(query string) []models.Stock
+	Search(query string, opts SearchOptions) (*SearchResult, error)
+	Suggest(prefix string, limit int) []Suggestion
 	GetBySymbol(symbol string) *models.Stock
 	GetStock(symbol, exchange string) *models.Stock
 }
 
+// ErrInvalidOptions is wrapped by every error caused by bad SearchOptions
+var ErrInvalidOptions = errors.New("invalid search options")
+
+// SearchOptions controls filtering, paging and ordering of search results
+type SearchOptions struct {
+	Limit  int
+	Offset int
+	Sort   string
+
+	// Filters maps a field from FilterFields to the values it may take. Values for
+	// one field are alternatives (OR); different fields must all match (AND)
+	Filters map[string][]string
+
+	// Explain attaches a score breakdown to every hit
+	Explain bool
+
+	// Profile names the ranking profile used for relevance sorting, DefaultProfile if empty
+	Profile string
+
+	// Group is GroupISIN (the default) to merge the listings of one company, or GroupNone
+	Group string
+
+	// ListedAfter and ListedBefore bound the listing date, inclusive, as YYYY-MM-DD
+	// or YYYY. A year alone means its first day for ListedAfter and its last for
+	// ListedBefore. Listings without a known date are excluded by either bound
+	ListedAfter  string
+	ListedBefore string
+
+	// IncludeInactive returns suspended and delisted listings, which are left out
+	// by default. A status filter also overrides the default
+	IncludeInactive bool
+}
+
+// excludesInactive reports whether suspended and delisted listings are left out
+func (o SearchOptions) excludesInactive() bool {
+	return !o.IncludeInactive && len(o.Filters["status"]) == 0
+}
+
+// Normalize fills in defaults and validates the options
+func (o SearchOptions) Normalize() (SearchOptions, error) {
+	if o.Limit == 0 {
+		o.Limit = DefaultLimit
+	}
+	if o.Limit < 0 || o.Limit > MaxLimit {
+		return o, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidOptions, MaxLimit)
+	}
+	if o.Offset < 0 || o.Offset > MaxOffset {
+		return o, fmt.Errorf("%w: offset must be between 0 and %d", ErrInvalidOptions, MaxOffset)
+	}
+	switch o.Sort {
+	case "":
+		o.Sort = SortRelevance
+	case SortRelevance, SortPopularity, SortSymbol, SortName, SortListingDate:
+	default:
+		return o, fmt.Errorf("%w: unsupported sort %q", ErrInvalidOptions, o.Sort)
+	}
+	if o.Profile == "" {
+		o.Profile = DefaultProfile
+	}
+	switch o.Group {
+	case "":
+		o.Group = GroupISIN
+	case GroupISIN, GroupNone:
+	default:
+		return o, fmt.Errorf("%w: unsupported group %q", ErrInvalidOptions, o.Group)
+	}
+	for field := range o.Filters {
+		if !isFilterField(field) {
+			return o, fmt.Errorf("%w: unsupported filter %q", ErrInvalidOptions, field)
+		}
+	}
+	var err error
+	if o.ListedAfter, err = normalizeDate(o.ListedAfter, "-01-01"); err != nil {
+		return o, fmt.Errorf("%w: listed_after: %v", ErrInvalidOptions, err)
+	}
+	if o.ListedBefore, err = normalizeDate(o.ListedBefore, "-12-31"); err != nil {
+		return o, fmt.Errorf("%w: listed_before: %v", ErrInvalidOptions, err)
+	}
+	return o, nil
+}
+
+// normalizeDate validates a YYYY-MM-DD or YYYY date, completing a bare year
+// with yearSuffix ("-01-01" or "-12-31")
+func normalizeDate(value, yearSuffix string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	if len(value) == 4 {
+		value += yearSuffix
+	}
+	if _, err := time.Parse("2006-01-02", value); err != nil {
+		return "", fmt.Errorf("%q is not a YYYY-MM-DD date or a year", value)
+	}
+	return value, nil
+}
+
+// listedWithin reports whether a stock's listing date is within the bounds of opts.
+// Dates are YYYY-MM-DD, so they compare as strings
+func listedWithin(stock models.Stock, opts SearchOptions) bool {
+	if opts.ListedAfter == "" && opts.ListedBefore == "" {
+		return true
+	}
+	if stock.ListingDate == "" {
+		return false
+	}
+	if opts.ListedAfter != "" && stock.ListingDate < opts.ListedAfter {
+		return false
+	}
+	if opts.ListedBefore != "" && stock.ListingDate > opts.ListedBefore {
+		return false
+	}
+	return true
+}
+
+func isFilterField(field string) bool {
+	for _, f := range FilterFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// filterValue returns the value of a filterable field of a stock
+func filterValue(stock models.Stock, field string) string {
+	switch field {
+	case "exchange":
+		return stock.Exchange
+	case "sector":
+		return stock.Sector
+	case "industry":
+		return stock.Industry
+	case "type":
+		return stock.Type
+	case "series":
+		return stock.Series
+	case "status":
+		if stock.Status == "" {
+			return models.StatusActive
+		}
+		return stock.Status
+	}
+	return ""
+}
+
+// matchesFilters reports whether a stock satisfies every filter
+func matchesFilters(stock models.Stock, filters map[string][]string) bool {
+	for field, values := range filters {
+		if len(values) == 0 {
+			continue
+		}
+		value := filterValue(stock, field)
+		matched := false
+		for _, v := range values {
+			if v == value {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// Clause names reported in Explanation.MatchedClauses
+const (
+	ClauseExactSymbol    = "exact_symbol"
+	ClauseExactISIN      = "exact_isin"
+	ClauseAlias          = "alias"
+	ClausePrefixSymbol   = "prefix_symbol"
+	ClauseNameMatch      = "name_match"
+	ClauseWildcardSymbol = "wildcard_symbol"
+	ClauseWildcardName   = "wildcard_name"
+	ClauseWildcardBrand  = "wildcard_brand"
+	ClauseFuzzy          = "fuzzy"
+	ClauseSemanticSector = "semantic_sector"
+)
+
+// Hit is a single ranked search result
+type Hit struct {
+	models.Stock
+	Score       float64          `json:"score"`
+	Listings    []models.Listing `json:"listings,omitempty"` // exchange listings merged into this hit when grouping by ISIN
+	Explanation *Explanation     `json:"explanation,omitempty"`
+
+	id string // engine document ID
+}
+
+// Explanation breaks a hit's score down into the parts that ranked it:
+// final_score = text_score * text_weight + normalized_popularity * popularity_weight
+type Explanation struct {
+	MatchedClauses       []string    `json:"matched_clauses"`
+	TextScore            float64     `json:"text_score"`
+	TextWeight           float64     `json:"text_weight"`
+	TextComponent        float64     `json:"text_component"`
+	PopularityScore      float64     `json:"popularity_score"`
+	NormalizedPopularity float64     `json:"normalized_popularity"`
+	PopularityWeight     float64     `json:"popularity_weight"`
+	PopularityComponent  float64     `json:"popularity_component"`
+	FinalScore           float64     `json:"final_score"`
+	Bleve                interface{} `json:"bleve,omitempty"` // raw scoring tree from the search engine
+}
+
+// FacetCount is the number of hits sharing one value of a filter field
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// SearchResult is one page of results together with the total hit count
+type SearchResult struct {
+	Total      int                     `json:"total"`
+	Offset     int                     `json:"offset"`
+	Limit      int                     `json:"limit"`
+	Sort       string                  `json:"sort"`
+	Profile    string                  `json:"profile,omitempty"`     // ranking profile used for relevance sorting
+	NextOffset *int                    `json:"next_offset,omitempty"` // nil when this is the last page
+	Results    []Hit                   `json:"results"`
+	Facets     map[string][]FacetCount `json:"facets,omitempty"` // counts over all matching listings, ungrouped, keyed by filter field
+
+	// Derivatives are the contracts matching a derivative query such as
+	// "NIFTY 24500 CE", grouped by underlying
+	Derivatives []DerivativeGroup `json:"derivatives,omitempty"`
+}
+
+// newSearchResult builds the envelope for one page of hits. A short page is the
+// last one, even when total is only an upper bound, as for grouped results
+// beyond the candidate pool
+func newSearchResult(total int, opts SearchOptions, hits []Hit) *SearchResult {
+	if hits == nil {
+		hits = []Hit{}
+	}
+	result := &SearchResult{
+		Total:   total,
+		Offset:  opts.Offset,
+		Limit:   opts.Limit,
+		Sort:    opts.Sort,
+		Results: hits,
+	}
+	if next := opts.Offset + len(hits); len(hits) == opts.Limit && next < total {
+		result.NextOffset = &next
+	}
+	return result
+}
+
+// paginate returns the window of hits selected by opts
+func paginate(hits []Hit, opts SearchOptions) []Hit {
+	if opts.Offset >= len(hits) {
+		return nil
+	}
+	end := opts.Offset + opts.Limit
+	if end > len(hits) {
+		end = len(hits)
+	}
+	return hits[opts.Offset:end]
+}
+
+// sortHits orders hits in place for the non-relevance sort modes
+func sortHits(hits []Hit, mode string) {
+	switch mode {
+	case SortPopularity:
+		sort.SliceStable(hits, func(i, j int) bool {
+			return hits[i].PopularityScore > hits[j].PopularityScore
+		})
+	case SortSymbol:
+		sort.SliceStable(hits, func(i, j int) bool {
+			return strings.ToLower(hits[i].Symbol) < strings.ToLower(hits[j].Symbol)
+		})
+	case SortName:
+		sort.SliceStable(hits, func(i, j int) bool {
+			return strings.ToLower(hits[i].Name) < strings.ToLower(hits[j].Name)
+		})
+	case SortListingDate:
+		sort.SliceStable(hits, func(i, j int) bool {
+			return hits[i].ListingDate > hits[j].ListingDate
+		})
+	}
+}
+
 type InMemoryEngine struct {
-	stocks []models.Stock
+	stocks    []models.Stock
+	suggester *Suggester
 }
 
 func NewInMemoryEngine(stocks []models.Stock) *InMemoryEngine {
-	return &InMemoryEngine{stocks: stocks}
+	return &InMemoryEngine{stocks: stocks, suggester: NewSuggester(stocks)}
+}
+
+func (e *InMemoryEngine) Suggest(prefix string, limit int) []Suggestion {
+	return e.suggester.Suggest(prefix, limit)
 }
 
-func (e *InMemoryEngine) Search(query string) []models.Stock {
-	var results []models.Stock
+func (e *InMemoryEngine) Search(query string, opts SearchOptions) (*SearchResult, error) {
+	opts, err := opts.Normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	var hits []Hit
+	counts := make(map[string]map[string]int)
 	q := strings.ToLower(query)
 	for _, stock := range e.stocks {
+		if !matchesFilters(stock, opts.Filters) || !listedWithin(stock, opts) {
+			continue
+		}
+		if opts.excludesInactive() && !stock.IsActive() {
+			continue
+		}
 		if strings.HasPrefix(strings.ToLower(stock.Symbol), q) ||
-			strings.Contains(strings.ToLower(stock.Name), q) {
-			results = append(results, stock)
+			strings.Contains(strings.ToLower(stock.Name), q) ||
+			strings.EqualFold(stock.ISIN, query) {
+			hit := Hit{Stock: stock, Score: stock.PopularityScore}
+			if opts.Explain {
+				clause := ClauseWildcardName
+				if strings.EqualFold(stock.Symbol, query) {
+					clause = ClauseExactSymbol
+				} else if strings.HasPrefix(strings.ToLower(stock.Symbol), q) {
+					clause = ClausePrefixSymbol
+				}
+				hit.Explanation = &Explanation{
+					MatchedClauses:       []string{clause},
+					PopularityScore:      stock.PopularityScore,
+					NormalizedPopularity: stock.PopularityScore,
+					PopularityWeight:     1,
+					PopularityComponent:  stock.PopularityScore,
+					FinalScore:           stock.PopularityScore,
+				}
+			}
+			hits = append(hits, hit)
+			for _, field := range FilterFields {
+				if value := filterValue(stock, field); value != "" {
+					if counts[field] == nil {
+						counts[field] = make(map[string]int)
+					}
+					counts[field][value]++
+				}
+			}
+		}
+	}
+	sortHits(hits, opts.Sort)
+	if opts.Group == GroupISIN {
+		hits = groupHits(hits)
+	}
+
+	result := newSearchResult(len(hits), opts, paginate(hits, opts))
+	result.Facets = make(map[string][]FacetCount)
+	for field, values := range counts {
+		for value, count := range values {
+			result.Facets[field] = append(result.Facets[field], FacetCount{Value: value, Count: count})
 		}
+		sort.Slice(result.Facets[field], func(i, j int) bool {
+			a, b := result.Facets[field][i], result.Facets[field][j]
+			return a.Count > b.Count || (a.Count == b.Count && a.Value < b.Value)
+		})
 	}
-	return results
+	return result, nil
 }
 
 func (e *InMemoryEngine) GetBySymbol(symbol string) *models.Stock {
@@ -37,7 +400,7 @@ func (e *InMemoryEngine) GetBySymbol(symbol string) *models.Stock {
 			return &stock
 		}
 	}
-	return nil
+	return e.getByAlias(symbol, "")
 }
 
 func (e *InMemoryEngine) GetStock(symbol, exchange string) *models.Stock {
@@ -46,6 +409,25 @@ func (e *InMemoryEngine) GetStock(symbol, exchange string) *models.Stock {
 			return &stock
 		}
 	}
+	if stock := e.getByAlias(symbol, exchange); stock != nil {
+		return stock
+	}
 	// Fallback to GetBySymbol if exchange doesn't match
 	return e.GetBySymbol(symbol)
 }
+
+// getByAlias finds the listing formerly traded as symbol, on any exchange if exchange is ""
+func (e *InMemoryEngine) getByAlias(symbol, exchange string) *models.Stock {
+	for _, stock := range e.stocks {
+		if exchange != "" && !strings.EqualFold(stock.Exchange, exchange) {
+			continue
+		}
+		for _, alias := range stock.Aliases {
+			if alias.Kind == models.AliasSymbol && strings.EqualFold(alias.Alias, symbol) {
+				stock.RenamedFrom = &alias
+				return &stock
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package search
+
+import (
+	"sort"
+	"stock-search/loader"
+	"stock-search/models"
+)
+
+// Supported values for SearchOptions.Group
+const (
+	GroupISIN = "isin" // one hit per company, with its exchange listings
+	GroupNone = "none" // one hit per listing
+)
+
+// groupHits merges hits sharing an ISIN into one hit per company, keeping the
+// position and score of the best ranked listing. The merged hit shows the NSE
+// listing when there is one and lists one listing per exchange, NSE first.
+// Hits without an ISIN stand alone
+func groupHits(hits []Hit) []Hit {
+	type group struct {
+		hit     Hit
+		members map[string]Hit // best listing per exchange
+	}
+
+	var order []*group
+	byISIN := make(map[string]*group)
+	for _, hit := range hits {
+		g := byISIN[hit.ISIN]
+		if g == nil || hit.ISIN == "" {
+			g = &group{hit: hit, members: make(map[string]Hit)}
+			order = append(order, g)
+			if hit.ISIN != "" {
+				byISIN[hit.ISIN] = g
+			}
+		}
+
+		current, ok := g.members[hit.Exchange]
+		if !ok || preferListing(hit.Exchange, current.Symbol, hit.Symbol) {
+			g.members[hit.Exchange] = hit
+		}
+	}
+
+	grouped := make([]Hit, 0, len(order))
+	for _, g := range order {
+		hit := g.hit
+		// The shown listing's document is the one explained
+		if nse, ok := g.members["NSE"]; ok && hit.Exchange != "NSE" {
+			hit.Stock, hit.id = nse.Stock, nse.id
+		}
+		symbols := make(map[string]string, len(g.members))
+		for exchange, member := range g.members {
+			symbols[exchange] = member.Symbol
+		}
+		hit.Listings = orderedListings(symbols)
+		grouped = append(grouped, hit)
+	}
+	return grouped
+}
+
+// orderedListings lists the symbol of a company on each exchange, NSE first,
+// then BSE, then any other exchange by name
+func orderedListings(symbols map[string]string) []models.Listing {
+	exchanges := make([]string, 0, len(symbols))
+	for exchange := range symbols {
+		if exchange != "NSE" && exchange != "BSE" {
+			exchanges = append(exchanges, exchange)
+		}
+	}
+	sort.Strings(exchanges)
+	exchanges = append([]string{"NSE", "BSE"}, exchanges...)
+
+	listings := make([]models.Listing, 0, len(symbols))
+	for _, exchange := range exchanges {
+		if symbol, ok := symbols[exchange]; ok {
+			listings = append(listings, models.Listing{Exchange: exchange, Symbol: symbol})
+		}
+	}
+	return listings
+}
+
+// preferListing reports whether a listing symbol should replace current as the
+// listing of its exchange in a group: a BSE row keyed by scrip code is the real
+// listing, curated rows reuse the NSE symbol
+func preferListing(exchange, current, symbol string) bool {
+	return exchange == "BSE" && !loader.IsScripCode(current) && loader.IsScripCode(symbol)
+}
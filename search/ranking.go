@@ -0,0 +1,144 @@
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+)
+
+// DefaultProfile is the ranking profile used when a request does not name one
+const DefaultProfile = "default"
+
+// Boost keys of a ranking profile: one per regular search clause, with the
+// fuzzy clause split per field
+const (
+	BoostFuzzySymbol = "fuzzy_symbol"
+	BoostFuzzyName   = "fuzzy_name"
+	BoostFuzzyBrand  = "fuzzy_brand"
+)
+
+// Popularity normalisation methods
+const (
+	NormalizeLinear = "linear" // use popularity as is
+	NormalizeSqrt   = "sqrt"   // lift the long tail of rarely traded stocks
+	NormalizeLog    = "log"    // stronger lift: log10(1 + 9p), still 0..1
+)
+
+// RankingProfile holds every tunable of relevance ranking:
+// final_score = text_score * text_weight + normalize(popularity) * popularity_weight
+type RankingProfile struct {
+	Boosts           map[string]float64      `json:"boosts"`
+	TextWeight       float64                 `json:"text_weight"`
+	PopularityWeight float64                 `json:"popularity_weight"`
+	Popularity       PopularityNormalization `json:"popularity"`
+}
+
+// PopularityNormalization maps a stock's raw 0..1 popularity into the value blended into its score
+type PopularityNormalization struct {
+	Method string  `json:"method"`
+	Floor  float64 `json:"floor"` // minimum normalised popularity, so unknown stocks are not zeroed out
+}
+
+// DefaultRankingProfile returns the built-in ranking used when no profile file is loaded
+func DefaultRankingProfile() RankingProfile {
+	return RankingProfile{
+		Boosts: map[string]float64{
+			ClauseExactSymbol:    10.0,
+			ClauseExactISIN:      10.0,
+			ClauseAlias:          8.0,
+			ClausePrefixSymbol:   5.0,
+			ClauseNameMatch:      3.0,
+			ClauseWildcardSymbol: 2.0,
+			ClauseWildcardName:   1.5,
+			ClauseWildcardBrand:  1.0,
+			BoostFuzzySymbol:     1.2,
+			BoostFuzzyName:       1.0,
+			BoostFuzzyBrand:      0.8,
+		},
+		TextWeight:       0.7,
+		PopularityWeight: 0.3,
+		Popularity:       PopularityNormalization{Method: NormalizeLinear},
+	}
+}
+
+// LoadRankingProfiles reads named profiles from a JSON object of the form
+// {"default": {...}, "popular_first": {...}}. Boosts a profile leaves out keep
+// their default values, and a "default" profile is added if the file has none
+func LoadRankingProfiles(filePath string) (map[string]RankingProfile, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var raw map[string]RankingProfile
+	if err := json.NewDecoder(file).Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	profiles := make(map[string]RankingProfile, len(raw)+1)
+	profiles[DefaultProfile] = DefaultRankingProfile()
+	for name, profile := range raw {
+		boosts := DefaultRankingProfile().Boosts
+		for key, boost := range profile.Boosts {
+			if _, ok := boosts[key]; !ok {
+				return nil, fmt.Errorf("profile %q: unknown boost %q", name, key)
+			}
+			boosts[key] = boost
+		}
+		profile.Boosts = boosts
+		if profile.Popularity.Method == "" {
+			profile.Popularity.Method = NormalizeLinear
+		}
+		if err := profile.validate(); err != nil {
+			return nil, fmt.Errorf("profile %q: %v", name, err)
+		}
+		profiles[name] = profile
+	}
+
+	return profiles, nil
+}
+
+func (p RankingProfile) validate() error {
+	for key, boost := range p.Boosts {
+		if boost < 0 {
+			return fmt.Errorf("boost %q must not be negative", key)
+		}
+	}
+	if p.TextWeight < 0 || p.PopularityWeight < 0 {
+		return fmt.Errorf("blend weights must not be negative")
+	}
+	if p.TextWeight == 0 && p.PopularityWeight == 0 {
+		return fmt.Errorf("at least one blend weight must be positive")
+	}
+	switch p.Popularity.Method {
+	case NormalizeLinear, NormalizeSqrt, NormalizeLog:
+	default:
+		return fmt.Errorf("unknown popularity normalization %q", p.Popularity.Method)
+	}
+	if p.Popularity.Floor < 0 || p.Popularity.Floor > 1 {
+		return fmt.Errorf("popularity floor must be between 0 and 1")
+	}
+	return nil
+}
+
+// boost returns the boost for a clause or fuzzy field key
+func (p RankingProfile) boost(key string) float64 {
+	if boost, ok := p.Boosts[key]; ok {
+		return boost
+	}
+	return DefaultRankingProfile().Boosts[key]
+}
+
+// normalizePopularity maps a raw 0..1 popularity score through the profile's normalisation
+func (p RankingProfile) normalizePopularity(popularity float64) float64 {
+	popularity = math.Max(0, math.Min(1, popularity))
+	switch p.Popularity.Method {
+	case NormalizeSqrt:
+		popularity = math.Sqrt(popularity)
+	case NormalizeLog:
+		popularity = math.Log10(1 + 9*popularity)
+	}
+	return math.Max(popularity, p.Popularity.Floor)
+}
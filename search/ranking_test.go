@@ -0,0 +1,72 @@
+package search
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadRankingProfiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profiles.json")
+	os.WriteFile(path, []byte(`{"exact": {"boosts": {"exact_symbol": 20}, "text_weight": 1, "popularity_weight": 0}}`), 0644)
+
+	profiles, err := LoadRankingProfiles(path)
+	if err != nil {
+		t.Fatalf("LoadRankingProfiles failed: %v", err)
+	}
+	if _, ok := profiles[DefaultProfile]; !ok {
+		t.Error("Expected the default profile to be added")
+	}
+	exact := profiles["exact"]
+	if exact.boost(ClauseExactSymbol) != 20 || exact.boost(ClausePrefixSymbol) != 5 {
+		t.Errorf("Expected overridden and default boosts, got %v", exact.Boosts)
+	}
+	if exact.Popularity.Method != NormalizeLinear {
+		t.Errorf("Expected linear normalization by default, got %q", exact.Popularity.Method)
+	}
+
+	os.WriteFile(path, []byte(`{"bad": {"boosts": {"exact_sym": 20}, "text_weight": 1}}`), 0644)
+	if _, err := LoadRankingProfiles(path); err == nil {
+		t.Error("Expected an error for an unknown boost")
+	}
+}
+
+func TestNormalizePopularity(t *testing.T) {
+	tests := []struct {
+		method string
+		floor  float64
+		in     float64
+		want   float64
+	}{
+		{NormalizeLinear, 0, 0.25, 0.25},
+		{NormalizeSqrt, 0, 0.25, 0.5},
+		{NormalizeLog, 0, 1, 1},
+		{NormalizeLinear, 0.1, 0, 0.1},
+		{NormalizeLinear, 0, 2, 1},
+	}
+	for _, tt := range tests {
+		profile := RankingProfile{Popularity: PopularityNormalization{Method: tt.method, Floor: tt.floor}}
+		if got := profile.normalizePopularity(tt.in); got != tt.want {
+			t.Errorf("%s(%v) with floor %v = %v, want %v", tt.method, tt.in, tt.floor, got, tt.want)
+		}
+	}
+}
+
+func TestSearchRankingProfile(t *testing.T) {
+	engine := newTestEngine(t, testStocks())
+
+	popularity := DefaultRankingProfile()
+	popularity.TextWeight = 0
+	popularity.PopularityWeight = 1
+	engine.SetRankingProfiles(map[string]RankingProfile{"popularity_only": popularity})
+
+	result := mustSearch(t, engine, "bank", SearchOptions{Profile: "popularity_only"})
+	if result.Profile != "popularity_only" || result.Results[0].Symbol != "HDFCBANK" {
+		t.Errorf("Expected HDFCBANK first under popularity_only, got %s (profile %q)", result.Results[0].Symbol, result.Profile)
+	}
+
+	if _, err := engine.Search("bank", SearchOptions{Profile: "missing"}); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("Expected ErrInvalidOptions for an unknown profile, got %v", err)
+	}
+}
@@ -0,0 +1,224 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"stock-search/models"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrRebuildInProgress is returned when a rebuild is requested while one is running
+var ErrRebuildInProgress = errors.New("index rebuild already in progress")
+
+// Rebuild states reported in RebuildStatus.State
+const (
+	RebuildIdle      = "idle"
+	RebuildRunning   = "running"
+	RebuildSucceeded = "succeeded"
+	RebuildFailed    = "failed"
+)
+
+// RebuildStatus describes the latest index rebuild
+type RebuildStatus struct {
+	State      string     `json:"state"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	IndexDir   string     `json:"index_dir,omitempty"` // directory the rebuild built into
+	DocCount   uint64     `json:"doc_count,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// rebuildTracker holds the status of the latest rebuild. It has its own lock so
+// the status can be read while a rebuild holds writeMu
+type rebuildTracker struct {
+	mu     sync.Mutex
+	status RebuildStatus
+}
+
+func (t *rebuildTracker) get() RebuildStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.status.State == "" {
+		return RebuildStatus{State: RebuildIdle}
+	}
+	return t.status
+}
+
+// start marks a rebuild as running, failing if one already is
+func (t *rebuildTracker) start() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.status.State == RebuildRunning {
+		return ErrRebuildInProgress
+	}
+	now := time.Now()
+	t.status = RebuildStatus{State: RebuildRunning, StartedAt: &now}
+	return nil
+}
+
+func (t *rebuildTracker) finish(indexDir string, docCount uint64, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	t.status.FinishedAt = &now
+	t.status.IndexDir = indexDir
+	t.status.DocCount = docCount
+	if err != nil {
+		t.status.State = RebuildFailed
+		t.status.Error = err.Error()
+	} else {
+		t.status.State = RebuildSucceeded
+	}
+}
+
+// RebuildStatus reports the state of the latest rebuild
+func (e *BleveEngine) RebuildStatus() RebuildStatus {
+	return e.rebuild.get()
+}
+
+// StartRebuild runs Rebuild in the background with the stocks returned by load,
+// so the data files are re-read as part of the rebuild. Once the new index is
+// serving, swapped is called with the stocks, if given, to bring data kept
+// outside the index up to date. Progress is reported by RebuildStatus
+func (e *BleveEngine) StartRebuild(load func() ([]models.Stock, error), swapped func([]models.Stock)) error {
+	if err := e.rebuild.start(); err != nil {
+		return err
+	}
+
+	go func() {
+		stocks, err := load()
+		if err != nil {
+			err = fmt.Errorf("failed to load stocks: %v", err)
+			log.Printf("Index rebuild failed: %v", err)
+			e.rebuild.finish("", 0, err)
+			return
+		}
+		indexDir, docCount, err := e.rebuildIndex(stocks)
+		if err != nil {
+			log.Printf("Index rebuild failed: %v", err)
+		} else if swapped != nil {
+			swapped(stocks)
+		}
+		e.rebuild.finish(indexDir, docCount, err)
+	}()
+	return nil
+}
+
+// Rebuild builds a fresh index from stocks in a new versioned directory while
+// the current index keeps serving queries. Once the new index is validated it
+// replaces the current one: queries in flight finish on the old index, which is
+// then closed and removed
+func (e *BleveEngine) Rebuild(stocks []models.Stock) error {
+	if err := e.rebuild.start(); err != nil {
+		return err
+	}
+	indexDir, docCount, err := e.rebuildIndex(stocks)
+	e.rebuild.finish(indexDir, docCount, err)
+	return err
+}
+
+func (e *BleveEngine) rebuildIndex(stocks []models.Stock) (string, uint64, error) {
+	e.writeMu.Lock()
+	defer e.writeMu.Unlock()
+
+	start := time.Now()
+	docs := e.prepareDocuments(stocks)
+
+	indexDir := versionedIndexDir(e.indexPath, start)
+	log.Printf("Rebuilding index into %s...", indexDir)
+	index, err := createIndex(indexDir)
+	if err != nil {
+		return indexDir, 0, err
+	}
+
+	discard := func(err error) (string, uint64, error) {
+		index.Close()
+		os.RemoveAll(indexDir)
+		return indexDir, 0, err
+	}
+
+	if _, err := syncIndex(index, docs); err != nil {
+		return discard(err)
+	}
+
+	// Validate before swapping: every document must have made it into the index
+	docCount, err := index.DocCount()
+	if err != nil {
+		return discard(fmt.Errorf("failed to count documents: %v", err))
+	}
+	if docCount != uint64(len(docs)) {
+		return discard(fmt.Errorf("rebuilt index has %d documents, expected %d", docCount, len(docs)))
+	}
+
+	if err := writeCurrentIndexDir(e.indexPath, indexDir); err != nil {
+		return discard(err)
+	}
+
+	suggester := NewSuggester(documentList(docs))
+
+	// Swapping waits for queries holding a read lock to finish on the old index
+	e.mu.Lock()
+	oldIndex, oldDir := e.index, e.indexDir
+	e.index, e.indexDir = index, indexDir
+	e.suggester = suggester
+	e.mu.Unlock()
+
+	if err := oldIndex.Close(); err != nil {
+		log.Printf("Warning: Failed to close previous index: %v", err)
+	}
+	// The unversioned base directory is left alone, older versions are removed
+	if oldDir != e.indexPath {
+		if err := os.RemoveAll(oldDir); err != nil {
+			log.Printf("Warning: Failed to remove previous index %s: %v", oldDir, err)
+		}
+	}
+
+	log.Printf("Index rebuilt with %d documents in %v, now serving %s", docCount, time.Since(start).Round(time.Millisecond), indexDir)
+	return indexDir, docCount, nil
+}
+
+// versionedIndexDir names the directory of an index rebuilt at t
+func versionedIndexDir(indexPath string, t time.Time) string {
+	return fmt.Sprintf("%s.v%s", indexPath, t.Format("20060102T150405.000"))
+}
+
+// currentIndexFile is the pointer file naming the index directory in use
+func currentIndexFile(indexPath string) string {
+	return indexPath + ".current"
+}
+
+// currentIndexDir returns the directory of the index in use: the one named in
+// the pointer file left by the last rebuild, or indexPath itself
+func currentIndexDir(indexPath string) (string, error) {
+	data, err := os.ReadFile(currentIndexFile(indexPath))
+	if os.IsNotExist(err) {
+		return indexPath, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read index pointer: %v", err)
+	}
+	name := strings.TrimSpace(string(data))
+	if name == "" {
+		return indexPath, nil
+	}
+	return filepath.Join(filepath.Dir(indexPath), name), nil
+}
+
+// writeCurrentIndexDir points the pointer file at indexDir. The file is
+// replaced with a rename, so a crash never leaves it half written
+func writeCurrentIndexDir(indexPath, indexDir string) error {
+	pointer := currentIndexFile(indexPath)
+	tmp := pointer + ".tmp"
+	if err := os.WriteFile(tmp, []byte(filepath.Base(indexDir)+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write index pointer: %v", err)
+	}
+	if err := os.Rename(tmp, pointer); err != nil {
+		return fmt.Errorf("failed to update index pointer: %v", err)
+	}
+	return nil
+}
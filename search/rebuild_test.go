@@ -0,0 +1,111 @@
+package search
+
+import (
+	"os"
+	"path/filepath"
+	"stock-search/models"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRebuildSwapsIndex(t *testing.T) {
+	dir := t.TempDir()
+	indexPath := filepath.Join(dir, "index.bleve")
+	semanticPath := filepath.Join(dir, "missing.json")
+
+	engine, err := NewBleveEngine(indexPath, testStocks(), semanticPath)
+	if err != nil {
+		t.Fatalf("NewBleveEngine failed: %v", err)
+	}
+
+	// Queries keep being answered while the index is rebuilt and swapped
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if _, err := engine.Search("bank", SearchOptions{}); err != nil {
+				t.Errorf("Search during rebuild failed: %v", err)
+				return
+			}
+		}
+	}()
+
+	stocks := testStocks()[:3]
+	if err := engine.Rebuild(stocks); err != nil {
+		t.Fatalf("Rebuild failed: %v", err)
+	}
+	first := engine.RebuildStatus()
+	if err := engine.Rebuild(stocks); err != nil {
+		t.Fatalf("Second rebuild failed: %v", err)
+	}
+	close(stop)
+	wg.Wait()
+
+	status := engine.RebuildStatus()
+	if status.State != RebuildSucceeded || status.DocCount != 3 {
+		t.Errorf("Unexpected rebuild status: %+v", status)
+	}
+	if result := mustSearch(t, engine, "tcs", SearchOptions{}); result.Total != 0 {
+		t.Errorf("Expected TCS to be gone after rebuild, got %+v", result.Results)
+	}
+	if _, err := os.Stat(first.IndexDir); !os.IsNotExist(err) {
+		t.Errorf("Expected superseded index %s to be removed", first.IndexDir)
+	}
+	if _, err := os.Stat(indexPath); err != nil {
+		t.Errorf("Expected the base index to be kept: %v", err)
+	}
+	engine.Close()
+
+	// A restart opens the rebuilt index
+	engine, err = NewBleveEngine(indexPath, stocks, semanticPath)
+	if err != nil {
+		t.Fatalf("NewBleveEngine failed: %v", err)
+	}
+	defer engine.Close()
+	if engine.indexDir != status.IndexDir {
+		t.Errorf("Expected restart to open %s, got %s", status.IndexDir, engine.indexDir)
+	}
+}
+
+func TestStartRebuild(t *testing.T) {
+	dir := t.TempDir()
+
+	// An engine opened without synchronising starts out empty
+	engine, err := OpenBleveEngine(filepath.Join(dir, "index.bleve"), filepath.Join(dir, "missing.json"))
+	if err != nil {
+		t.Fatalf("OpenBleveEngine failed: %v", err)
+	}
+	defer engine.Close()
+	if result := mustSearch(t, engine, "tcs", SearchOptions{}); result.Total != 0 {
+		t.Fatalf("Expected an empty index, got %+v", result.Results)
+	}
+
+	// swapped sees the stocks once the rebuilt index serves them
+	swapped := make(chan int, 1)
+	err = engine.StartRebuild(
+		func() ([]models.Stock, error) { return testStocks(), nil },
+		func(stocks []models.Stock) {
+			result, _ := engine.Search("tcs", SearchOptions{})
+			swapped <- result.Total
+		},
+	)
+	if err != nil {
+		t.Fatalf("StartRebuild failed: %v", err)
+	}
+	select {
+	case total := <-swapped:
+		if total == 0 {
+			t.Error("Expected the rebuilt index to be serving when swapped is called")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Expected swapped to be called")
+	}
+}
@@ -0,0 +1,263 @@
+package search
+
+import (
+	"sort"
+	"stock-search/models"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	DefaultSuggestLimit = 8
+	MaxSuggestLimit     = 20
+)
+
+// Span marks a highlighted range of a suggestion's text, in characters [Start, End)
+type Span struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Suggestion is a single autocomplete completion
+type Suggestion struct {
+	Symbol     string  `json:"symbol"`
+	Name       string  `json:"name"`
+	Exchange   string  `json:"exchange"`
+	Field      string  `json:"field"` // symbol, name or brand
+	Text       string  `json:"text"`  // value of the matched field
+	Highlights []Span  `json:"highlights"`
+	Score      float64 `json:"score"`
+
+	Listings []models.Listing `json:"listings,omitempty"` // exchange listings of the company, sharing an ISIN
+}
+
+// Field bonuses added to popularity when ranking completions, so a symbol match
+// outranks a name match, which outranks a word inside a name or a brand
+const (
+	symbolBonus    = 0.5
+	nameStartBonus = 0.3
+	brandBonus     = 0.2
+	nameWordBonus  = 0.1
+	exactBonus     = 1.0
+)
+
+// suggestStopWords are name words that never start a completion on their own
+var suggestStopWords = map[string]bool{
+	"limited": true, "ltd": true, "ltd.": true, "the": true, "of": true,
+	"and": true, "&": true, "co": true, "co.": true, "inc": true,
+}
+
+// suggestEntry is one indexed completion key pointing at a stock
+type suggestEntry struct {
+	key   string // lowercased text from the start of the matched word
+	stock int    // index into Suggester.stocks
+	field string
+	text  string  // original field value the key was taken from
+	start int     // character offset of key within text
+	score float64 // popularity plus field bonus
+}
+
+// Suggester answers prefix lookups from an in-memory sorted key list. Each stock
+// contributes its symbol, every significant word of its name (so "ind" finds
+// "Reliance Industries") and every brand. A lookup is a binary search for the
+// first key with the prefix followed by a scan of the matching range
+//
+// Prefixes of up to cachedPrefixLen characters match a large share of all keys,
+// so their results are computed once when the suggester is built
+type Suggester struct {
+	stocks  []models.Stock
+	entries []suggestEntry
+	cached  map[string][]Suggestion
+}
+
+const cachedPrefixLen = 3
+
+// NewSuggester builds the prefix index over stocks
+func NewSuggester(stocks []models.Stock) *Suggester {
+	s := &Suggester{stocks: stocks}
+	for i, stock := range stocks {
+		// Suspended and delisted listings are not suggested
+		if !stock.IsActive() {
+			continue
+		}
+		if stock.Symbol != "" {
+			s.entries = append(s.entries, suggestEntry{
+				key: strings.ToLower(stock.Symbol), stock: i, field: "symbol", text: stock.Symbol,
+				score: stock.PopularityScore + symbolBonus,
+			})
+		}
+		s.addWords(i, "name", stock.Name, stock.PopularityScore+nameStartBonus, stock.PopularityScore+nameWordBonus)
+		for _, brand := range strings.Split(stock.Brand, ",") {
+			s.addWords(i, "brand", strings.TrimSpace(brand), stock.PopularityScore+brandBonus, stock.PopularityScore+brandBonus/2)
+		}
+	}
+
+	sort.Slice(s.entries, func(i, j int) bool {
+		return s.entries[i].key < s.entries[j].key
+	})
+
+	s.cached = make(map[string][]Suggestion)
+	for _, entry := range s.entries {
+		runes := []rune(entry.key)
+		for n := 1; n <= cachedPrefixLen && n <= len(runes); n++ {
+			prefix := string(runes[:n])
+			if _, ok := s.cached[prefix]; !ok {
+				s.cached[prefix] = s.lookup(prefix, MaxSuggestLimit)
+			}
+		}
+	}
+	return s
+}
+
+// addWords indexes text from the start of each significant word. The first word
+// scores startScore, later words wordScore
+func (s *Suggester) addWords(stock int, field, text string, startScore, wordScore float64) {
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		// Only word starts begin a key
+		if unicode.IsSpace(runes[i]) || (i > 0 && !unicode.IsSpace(runes[i-1])) {
+			continue
+		}
+		end := i
+		for end < len(runes) && !unicode.IsSpace(runes[end]) {
+			end++
+		}
+		word := strings.ToLower(string(runes[i:end]))
+
+		score := wordScore
+		if i == 0 {
+			score = startScore
+		} else if suggestStopWords[word] {
+			continue
+		}
+		s.entries = append(s.entries, suggestEntry{
+			key: strings.ToLower(string(runes[i:])), stock: stock, field: field, text: text, start: i, score: score,
+		})
+	}
+}
+
+// Suggest returns up to limit completions for prefix, best first, with at most
+// one completion per company: listings sharing an ISIN complete as one, showing
+// the NSE listing when it matched
+func (s *Suggester) Suggest(prefix string, limit int) []Suggestion {
+	prefix = strings.ToLower(strings.TrimSpace(prefix))
+	if prefix == "" || limit <= 0 {
+		return []Suggestion{}
+	}
+
+	suggestions, ok := s.cached[prefix]
+	if !ok {
+		suggestions = s.lookup(prefix, limit)
+	}
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions
+}
+
+// lookup scans the key range starting with prefix and ranks the best entry of
+// each company
+func (s *Suggester) lookup(prefix string, limit int) []Suggestion {
+	type candidate struct {
+		entry int
+		score float64
+	}
+
+	first := sort.Search(len(s.entries), func(i int) bool {
+		return s.entries[i].key >= prefix
+	})
+
+	best := make(map[int]candidate)
+	prefixLen := utf8.RuneCountInString(prefix)
+	for i := first; i < len(s.entries) && strings.HasPrefix(s.entries[i].key, prefix); i++ {
+		entry := &s.entries[i]
+		score := entry.score
+		if entry.start == 0 && entry.field != "brand" && utf8.RuneCountInString(entry.text) == prefixLen {
+			score += exactBonus
+		}
+		if current, ok := best[entry.stock]; !ok || score > current.score {
+			best[entry.stock] = candidate{entry: i, score: score}
+		}
+	}
+
+	stockOf := func(c candidate) models.Stock {
+		return s.stocks[s.entries[c.entry].stock]
+	}
+	better := func(a, b candidate) bool {
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		x, y := stockOf(a), stockOf(b)
+		if x.Symbol != y.Symbol {
+			return x.Symbol < y.Symbol
+		}
+		return x.Exchange < y.Exchange
+	}
+	// The NSE listing of a company is shown when it matched, as in grouped search results
+	showFirst := func(a, b candidate) bool {
+		if x, y := stockOf(a).Exchange == "NSE", stockOf(b).Exchange == "NSE"; x != y {
+			return x
+		}
+		return better(a, b)
+	}
+
+	// Listings sharing an ISIN merge into one company, ranked by its best
+	// listing; listings without an ISIN stand alone
+	type company struct {
+		best    candidate
+		shown   candidate
+		symbols map[string]string // symbol per exchange
+	}
+	companies := make(map[string]*company)
+	for i, c := range best {
+		stock := s.stocks[i]
+		key := stock.ISIN
+		if key == "" {
+			key = "#" + strconv.Itoa(i)
+		}
+		g := companies[key]
+		if g == nil {
+			g = &company{best: c, shown: c, symbols: make(map[string]string)}
+			companies[key] = g
+		}
+		if better(c, g.best) {
+			g.best = c
+		}
+		if showFirst(c, g.shown) {
+			g.shown = c
+		}
+		if current, ok := g.symbols[stock.Exchange]; !ok || preferListing(stock.Exchange, current, stock.Symbol) {
+			g.symbols[stock.Exchange] = stock.Symbol
+		}
+	}
+
+	ranked := make([]*company, 0, len(companies))
+	for _, g := range companies {
+		ranked = append(ranked, g)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		return better(ranked[i].best, ranked[j].best)
+	})
+	if len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+
+	suggestions := make([]Suggestion, 0, len(ranked))
+	for _, g := range ranked {
+		entry := s.entries[g.shown.entry]
+		stock := s.stocks[entry.stock]
+		suggestions = append(suggestions, Suggestion{
+			Symbol:     stock.Symbol,
+			Name:       stock.Name,
+			Exchange:   stock.Exchange,
+			Field:      entry.field,
+			Text:       entry.text,
+			Highlights: []Span{{Start: entry.start, End: entry.start + prefixLen}},
+			Score:      g.best.score,
+			Listings:   orderedListings(g.symbols),
+		})
+	}
+	return suggestions
+}
@@ -0,0 +1,110 @@
+package search
+
+import (
+	"fmt"
+	"stock-search/models"
+	"testing"
+)
+
+func TestSuggest(t *testing.T) {
+	suggester := NewSuggester(testStocks())
+
+	tests := []struct {
+		prefix string
+		symbol string
+		field  string
+		span   Span
+	}{
+		{"rel", "RELIANCE", "symbol", Span{0, 3}},
+		{"indus", "RELIANCE", "name", Span{9, 14}},
+		{"jio", "RELIANCE", "brand", Span{0, 3}},
+		{"fina", "INFY", "brand", Span{0, 4}},
+		{"tcs", "TCS", "symbol", Span{0, 3}},
+	}
+
+	for _, tt := range tests {
+		suggestions := suggester.Suggest(tt.prefix, 5)
+		if len(suggestions) == 0 {
+			t.Errorf("Suggest(%q) returned nothing", tt.prefix)
+			continue
+		}
+		top := suggestions[0]
+		if top.Symbol != tt.symbol || top.Field != tt.field {
+			t.Errorf("Suggest(%q) top = %s/%s, want %s/%s", tt.prefix, top.Symbol, top.Field, tt.symbol, tt.field)
+		}
+		if len(top.Highlights) != 1 || top.Highlights[0] != tt.span {
+			t.Errorf("Suggest(%q) highlights = %v, want %v", tt.prefix, top.Highlights, tt.span)
+		}
+	}
+}
+
+func TestSuggestOnePerListing(t *testing.T) {
+	suggester := NewSuggester(testStocks())
+
+	// "hdfc" matches HDFCBANK's symbol, name and brand; it must be returned once
+	suggestions := suggester.Suggest("hdfc", 10)
+	if len(suggestions) != 1 || suggestions[0].Field != "symbol" {
+		t.Errorf("Expected a single symbol suggestion, got %+v", suggestions)
+	}
+
+	if got := suggester.Suggest("limited", 10); len(got) != 0 {
+		t.Errorf("Expected stop word to yield no suggestions, got %+v", got)
+	}
+}
+
+func TestSuggestGroupsByISIN(t *testing.T) {
+	suggester := NewSuggester([]models.Stock{
+		{Symbol: "RELIANCE", Name: "Reliance Industries Limited", Exchange: "NSE", ISIN: "INE002A01018", PopularityScore: 0.9},
+		{Symbol: "RELIANCE", Name: "Reliance Industries Limited", Exchange: "BSE", ISIN: "INE002A01018", PopularityScore: 0.9},
+		{Symbol: "500325", Name: "Reliance Industries Limited", Exchange: "BSE", ISIN: "INE002A01018", PopularityScore: 1.0},
+		{Symbol: "RELINFRA", Name: "Reliance Infrastructure Limited", Exchange: "NSE", PopularityScore: 0.5},
+	})
+
+	// The listings of a company complete as one suggestion, showing the NSE one
+	suggestions := suggester.Suggest("reli", 10)
+	if len(suggestions) != 2 {
+		t.Fatalf("Expected one suggestion per company, got %+v", suggestions)
+	}
+	top := suggestions[0]
+	if top.Symbol != "RELIANCE" || top.Exchange != "NSE" {
+		t.Errorf("Expected the NSE listing of RELIANCE first, got %s (%s)", top.Symbol, top.Exchange)
+	}
+	want := []models.Listing{{Exchange: "NSE", Symbol: "RELIANCE"}, {Exchange: "BSE", Symbol: "500325"}}
+	if fmt.Sprint(top.Listings) != fmt.Sprint(want) {
+		t.Errorf("Expected listings %v, got %v", want, top.Listings)
+	}
+	if other := suggestions[1]; other.Symbol != "RELINFRA" || len(other.Listings) != 1 {
+		t.Errorf("Expected RELINFRA on its own, got %+v", other)
+	}
+}
+
+func BenchmarkSuggest(b *testing.B) {
+	// A universe the size of NSE+BSE with names built from a shared vocabulary,
+	// so prefixes match realistic numbers of listings
+	words := []string{
+		"Reliance", "Tata", "Bajaj", "Adani", "Mahindra", "Hindustan", "Bharat", "Indian",
+		"National", "Global", "United", "Capital", "Power", "Steel", "Cement", "Pharma",
+		"Chemicals", "Textiles", "Motors", "Finance", "Bank", "Infra", "Energy", "Foods",
+		"Auto", "Tech", "Systems", "Industries", "Ventures", "Holdings", "Gas", "Oil",
+		"Metals", "Paper", "Sugar", "Agro", "Realty", "Logistics", "Media", "Healthcare",
+	}
+	var stocks []models.Stock
+	for i := 0; i < 6000; i++ {
+		name := fmt.Sprintf("%s %s %s Limited", words[i%len(words)], words[(i/len(words))%len(words)], words[(i*7)%len(words)])
+		stocks = append(stocks, models.Stock{
+			Symbol:          fmt.Sprintf("%.4s%d", words[(i*3)%len(words)], i),
+			Name:            name,
+			Exchange:        "NSE",
+			PopularityScore: float64(i%100) / 100,
+		})
+	}
+	suggester := NewSuggester(stocks)
+
+	for _, prefix := range []string{"r", "re", "rel", "relia", "reliance tata"} {
+		b.Run(prefix, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				suggester.Suggest(prefix, DefaultSuggestLimit)
+			}
+		})
+	}
+}
@@ -0,0 +1,305 @@
+package search
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"stock-search/models"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+// indexMappingVersion must be bumped whenever buildIndexMapping changes, so
+// indexes built with an older mapping are rebuilt instead of synchronised
+const indexMappingVersion = 8
+
+// Keys of the metadata stored alongside the documents with SetInternal
+var (
+	internalMappingVersion = []byte("_mapping_version")
+	internalFingerprint    = []byte("_fingerprint")
+	internalDocHashes      = []byte("_doc_hashes")
+)
+
+// SyncSummary counts the documents changed by a Sync
+type SyncSummary struct {
+	Added     int `json:"added"`
+	Updated   int `json:"updated"`
+	Deleted   int `json:"deleted"`
+	Unchanged int `json:"unchanged"`
+
+	// Document IDs (SYMBOL-EXCHANGE) behind the counts, sorted
+	AddedIDs   []string `json:"added_ids,omitempty"`
+	UpdatedIDs []string `json:"updated_ids,omitempty"`
+	DeletedIDs []string `json:"deleted_ids,omitempty"`
+}
+
+// Changed reports whether the sync modified the index
+func (s SyncSummary) Changed() bool {
+	return s.Added+s.Updated+s.Deleted > 0
+}
+
+func (s SyncSummary) String() string {
+	return fmt.Sprintf("%d added, %d updated, %d deleted, %d unchanged", s.Added, s.Updated, s.Deleted, s.Unchanged)
+}
+
+// Details lists the changed document IDs, at most limit per kind of change
+func (s SyncSummary) Details(limit int) string {
+	var parts []string
+	for _, change := range []struct {
+		name string
+		ids  []string
+	}{
+		{"added", s.AddedIDs},
+		{"updated", s.UpdatedIDs},
+		{"deleted", s.DeletedIDs},
+	} {
+		if len(change.ids) == 0 {
+			continue
+		}
+		part := change.name + ": "
+		if len(change.ids) > limit {
+			part += strings.Join(change.ids[:limit], ", ") + fmt.Sprintf(" and %d more", len(change.ids)-limit)
+		} else {
+			part += strings.Join(change.ids, ", ")
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// openIndex opens the index at indexPath, creating it if it does not exist and
+// rebuilding it from scratch if it was built with a different mapping version
+func openIndex(indexPath string) (bleve.Index, error) {
+	index, err := bleve.Open(indexPath)
+	if err == bleve.ErrorIndexPathDoesNotExist {
+		return createIndex(indexPath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open index: %v", err)
+	}
+
+	version, err := index.GetInternal(internalMappingVersion)
+	if err != nil {
+		index.Close()
+		return nil, fmt.Errorf("failed to read index metadata: %v", err)
+	}
+	if string(version) != fmt.Sprint(indexMappingVersion) {
+		log.Printf("Index mapping changed (version %q, want %d), rebuilding index", version, indexMappingVersion)
+		index.Close()
+		if err := os.RemoveAll(indexPath); err != nil {
+			return nil, fmt.Errorf("failed to remove outdated index: %v", err)
+		}
+		return createIndex(indexPath)
+	}
+
+	log.Println("Opened existing index.")
+	return index, nil
+}
+
+func createIndex(indexPath string) (bleve.Index, error) {
+	index, err := bleve.New(indexPath, buildIndexMapping())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create index: %v", err)
+	}
+	if err := index.SetInternal(internalMappingVersion, []byte(fmt.Sprint(indexMappingVersion))); err != nil {
+		index.Close()
+		return nil, fmt.Errorf("failed to write index metadata: %v", err)
+	}
+	return index, nil
+}
+
+// Sync brings the index in line with stocks: only documents that were added,
+// changed or removed since the last sync are written. A content fingerprint of
+// all documents is stored in the index, so an unchanged data set costs a
+// single metadata read
+func (e *BleveEngine) Sync(stocks []models.Stock) (SyncSummary, error) {
+	e.writeMu.Lock()
+	defer e.writeMu.Unlock()
+
+	docs := e.prepareDocuments(stocks)
+
+	// Only writers replace e.index, and they hold writeMu, so it is safe to
+	// use without e.mu here. Bleve serves queries concurrently with the batch
+	summary, err := syncIndex(e.index, docs)
+	if err != nil {
+		return summary, err
+	}
+
+	suggester := NewSuggester(documentList(docs))
+	e.mu.Lock()
+	e.suggester = suggester
+	e.mu.Unlock()
+	return summary, nil
+}
+
+// syncIndex writes the documents of docs that differ from index, deletes the
+// ones docs no longer has, and records the new hashes and fingerprint
+func syncIndex(index bleve.Index, docs map[string]models.Stock) (SyncSummary, error) {
+	var summary SyncSummary
+
+	hashes := make(map[string]string, len(docs))
+	for id, stock := range docs {
+		hash, err := documentHash(stock)
+		if err != nil {
+			return summary, err
+		}
+		hashes[id] = hash
+	}
+	fingerprint := fingerprintOf(hashes)
+
+	stored, err := index.GetInternal(internalFingerprint)
+	if err != nil {
+		return summary, fmt.Errorf("failed to read index fingerprint: %v", err)
+	}
+	if string(stored) == fingerprint {
+		summary.Unchanged = len(docs)
+		return summary, nil
+	}
+
+	indexed := make(map[string]string)
+	if raw, err := index.GetInternal(internalDocHashes); err != nil {
+		return summary, fmt.Errorf("failed to read document hashes: %v", err)
+	} else if raw != nil {
+		if err := json.Unmarshal(raw, &indexed); err != nil {
+			// Unreadable hashes only cost a full re-index
+			log.Printf("Warning: Discarding unreadable document hashes: %v", err)
+			indexed = make(map[string]string)
+		}
+	}
+
+	batch := index.NewBatch()
+	for id, hash := range hashes {
+		old, ok := indexed[id]
+		switch {
+		case !ok:
+			summary.Added++
+			summary.AddedIDs = append(summary.AddedIDs, id)
+		case old != hash:
+			summary.Updated++
+			summary.UpdatedIDs = append(summary.UpdatedIDs, id)
+		default:
+			summary.Unchanged++
+			continue
+		}
+		if err := batch.Index(id, docs[id]); err != nil {
+			return summary, fmt.Errorf("failed to add to batch: %v", err)
+		}
+	}
+	for id := range indexed {
+		if _, ok := hashes[id]; !ok {
+			batch.Delete(id)
+			summary.Deleted++
+			summary.DeletedIDs = append(summary.DeletedIDs, id)
+		}
+	}
+	sort.Strings(summary.AddedIDs)
+	sort.Strings(summary.UpdatedIDs)
+	sort.Strings(summary.DeletedIDs)
+
+	raw, err := json.Marshal(hashes)
+	if err != nil {
+		return summary, fmt.Errorf("failed to encode document hashes: %v", err)
+	}
+	batch.SetInternal(internalDocHashes, raw)
+	batch.SetInternal(internalFingerprint, []byte(fingerprint))
+
+	if err := index.Batch(batch); err != nil {
+		return summary, fmt.Errorf("failed to execute batch: %v", err)
+	}
+	return summary, nil
+}
+
+// prepareDocuments enriches stocks with sector and industry from the semantic
+// mappings, defaults their status to active and keys them by document ID. Later
+// stocks replace earlier ones with the same ID, so curated data loaded last wins
+func (e *BleveEngine) prepareDocuments(stocks []models.Stock) map[string]models.Stock {
+	docs := make(map[string]models.Stock, len(stocks))
+	for _, stock := range stocks {
+		if e.semantic != nil {
+			if stock.Sector == "" {
+				stock.Sector = e.semantic.GetSectorForSymbol(stock.Symbol)
+				stock.Provenance = withProvenance(stock.Provenance, "sector", stock.Sector)
+			}
+			if stock.Industry == "" {
+				stock.Industry = e.semantic.GetIndustryForSymbol(stock.Symbol)
+				stock.Provenance = withProvenance(stock.Provenance, "industry", stock.Industry)
+			}
+		}
+		// Listings without a status feed are indexed as active so the status
+		// filter finds them
+		if stock.Status == "" {
+			stock.Status = models.StatusActive
+		}
+		docs[documentID(stock)] = stock
+	}
+	return docs
+}
+
+// provenanceSectorMappings is the provenance of sectors and industries filled in
+// from the sector mappings
+const provenanceSectorMappings = "sector_mappings"
+
+// withProvenance returns a copy of provenance recording the sector mappings as
+// the source of field, if they supplied a value. The map may be shared by
+// other copies of the stock, so it is never modified in place
+func withProvenance(provenance map[string]string, field, value string) map[string]string {
+	if value == "" {
+		return provenance
+	}
+	updated := make(map[string]string, len(provenance)+1)
+	for k, v := range provenance {
+		updated[k] = v
+	}
+	updated[field] = provenanceSectorMappings
+	return updated
+}
+
+// documentID is the index ID of a listing. Symbols repeat across exchanges
+// (e.g. RELIANCE on NSE and BSE), so the exchange is part of the ID
+func documentID(stock models.Stock) string {
+	return fmt.Sprintf("%s-%s", stock.Symbol, stock.Exchange)
+}
+
+// documentList returns docs ordered by ID, so suggestions are built deterministically
+func documentList(docs map[string]models.Stock) []models.Stock {
+	ids := make([]string, 0, len(docs))
+	for id := range docs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	stocks := make([]models.Stock, len(ids))
+	for i, id := range ids {
+		stocks[i] = docs[id]
+	}
+	return stocks
+}
+
+func documentHash(stock models.Stock) (string, error) {
+	data, err := json.Marshal(stock)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode %s: %v", documentID(stock), err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16]), nil
+}
+
+// fingerprintOf combines the per-document hashes into one hash of the whole data set
+func fingerprintOf(hashes map[string]string) string {
+	ids := make([]string, 0, len(hashes))
+	for id := range hashes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	h := sha256.New()
+	for _, id := range ids {
+		fmt.Fprintf(h, "%s=%s\n", id, hashes[id])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,64 @@
+package search
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSyncIncremental(t *testing.T) {
+	indexPath := filepath.Join(t.TempDir(), "index.bleve")
+	semanticPath := filepath.Join(t.TempDir(), "missing.json")
+
+	engine, err := NewBleveEngine(indexPath, testStocks(), semanticPath)
+	if err != nil {
+		t.Fatalf("NewBleveEngine failed: %v", err)
+	}
+	engine.Close()
+
+	// Reopen the existing index rather than building a new one
+	engine, err = NewBleveEngine(indexPath, testStocks(), semanticPath)
+	if err != nil {
+		t.Fatalf("NewBleveEngine failed: %v", err)
+	}
+	defer engine.Close()
+
+	stocks := testStocks()
+	stocks[0].Brand = "Jio, Reliance Retail" // RELIANCE updated
+	stocks = stocks[:len(stocks)-1]          // TCS deleted
+	stocks = append(stocks, testStocks()[0]) // duplicate ID, later entry wins
+	stocks[len(stocks)-1].Brand = "JioMart"
+	stocks = append(stocks, stocks[1])
+	stocks[len(stocks)-1].Exchange = "BSE" // INFY-BSE added
+
+	summary, err := engine.Sync(stocks)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if summary.String() != "1 added, 1 updated, 1 deleted, 4 unchanged" {
+		t.Errorf("Unexpected sync summary: %s", summary)
+	}
+	if details := summary.Details(5); details != "added: INFY-BSE; updated: RELIANCE-NSE; deleted: TCS-NSE" {
+		t.Errorf("Unexpected sync details: %s", details)
+	}
+
+	if stock := engine.GetStock("RELIANCE", "NSE"); stock == nil || stock.Brand != "JioMart" {
+		t.Errorf("Expected RELIANCE brand to be updated, got %+v", stock)
+	}
+	if stock := engine.GetBySymbol("TCS"); stock != nil {
+		t.Errorf("Expected TCS to be deleted, got %+v", stock)
+	}
+	if stock := engine.GetStock("INFY", "BSE"); stock == nil || stock.Exchange != "BSE" {
+		t.Errorf("Expected INFY on BSE to be added, got %+v", stock)
+	}
+	if got := engine.Suggest("tcs", 5); len(got) != 0 {
+		t.Errorf("Expected no suggestions for a deleted listing, got %+v", got)
+	}
+
+	summary, err = engine.Sync(stocks)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if summary.Changed() || summary.Unchanged != 6 {
+		t.Errorf("Expected an unchanged re-sync, got %+v", summary)
+	}
+}
@@ -2,8 +2,15 @@ console.log('app.js v8 loaded - with UI updates');
 
 const searchInput = document.getElementById('searchInput');
 const resultsContainer = document.getElementById('results');
+const facetsContainer = document.getElementById('facets');
+
+// Facet fields shown as chips, in display order
+const FACET_FIELDS = ['exchange', 'type', 'sector', 'series'];
 
 let debounceTimer;
+let currentQuery = '';
+// Active filters, e.g. { exchange: ['NSE'], sector: ['Banking'] }
+let activeFilters = {};
 
 if (searchInput) {
     searchInput.addEventListener('input', (e) => {
@@ -11,34 +18,181 @@ if (searchInput) {
         const query = e.target.value.trim();
 
         if (query.length === 0) {
+            activeFilters = {};
+            facetsContainer.innerHTML = '';
             resultsContainer.innerHTML = '<div class="empty-state"><p>Start typing to search...</p></div>';
             return;
         }
 
+        // Suggestions are cheap enough to request on (almost) every keystroke
         debounceTimer = setTimeout(() => {
+            fetchSuggestions(query);
+        }, 50);
+    });
+
+    // Enter runs the full search, with facets and paging
+    searchInput.addEventListener('keydown', (e) => {
+        const query = searchInput.value.trim();
+        if (e.key === 'Enter' && query.length > 0) {
+            clearTimeout(debounceTimer);
+            activeFilters = {};
             fetchStocks(query);
-        }, 300);
+        }
+    });
+}
+
+function escapeHtml(text) {
+    const div = document.createElement('div');
+    div.textContent = text;
+    return div.innerHTML;
+}
+
+// highlightText wraps the highlighted character ranges of text in <mark>
+function highlightText(text, highlights) {
+    const chars = Array.from(text);
+    let html = '';
+    let pos = 0;
+    (highlights || []).forEach(span => {
+        html += escapeHtml(chars.slice(pos, span.start).join(''));
+        html += `<mark>${escapeHtml(chars.slice(span.start, span.end).join(''))}</mark>`;
+        pos = span.end;
+    });
+    return html + escapeHtml(chars.slice(pos).join(''));
+}
+
+async function fetchSuggestions(query) {
+    try {
+        const response = await fetch(`/api/suggest?q=${encodeURIComponent(query)}`);
+        if (!response.ok) {
+            throw new Error('Network response was not ok');
+        }
+        const data = await response.json();
+
+        // Ignore responses for a query the user has already typed past
+        if (searchInput.value.trim() !== query) {
+            return;
+        }
+        displaySuggestions(data.suggestions);
+    } catch (error) {
+        console.error('Error fetching suggestions:', error);
+    }
+}
+
+function displaySuggestions(suggestions) {
+    facetsContainer.innerHTML = '';
+    resultsContainer.innerHTML = '';
+
+    if (!suggestions || suggestions.length === 0) {
+        resultsContainer.innerHTML = '<div class="empty-state"><p>No stocks found. Press Enter to search.</p></div>';
+        return;
+    }
+
+    suggestions.forEach(suggestion => {
+        const symbol = suggestion.field === 'symbol'
+            ? highlightText(suggestion.symbol, suggestion.highlights)
+            : escapeHtml(suggestion.symbol);
+        const name = suggestion.field === 'name'
+            ? highlightText(suggestion.name, suggestion.highlights)
+            : escapeHtml(suggestion.name);
+
+        const card = document.createElement('a');
+        card.className = 'stock-card';
+        card.href = `/stock.html?symbol=${encodeURIComponent(suggestion.symbol)}&exchange=${encodeURIComponent(suggestion.exchange)}`;
+        card.innerHTML = `
+            <div class="card-header">
+                <span class="symbol">${symbol}</span>
+                <span class="exchange-badge">${escapeHtml(suggestion.exchange)}</span>
+            </div>
+            <div class="name">${name}</div>
+            ${suggestion.field === 'brand' ? `<div class="brand-match">${highlightText(suggestion.text, suggestion.highlights)}</div>` : ''}
+        `;
+        resultsContainer.appendChild(card);
     });
 }
 
-async function fetchStocks(query) {
+function filterParams() {
+    return Object.entries(activeFilters)
+        .flatMap(([field, values]) => values.map(v => `&${field}=${encodeURIComponent(v)}`))
+        .join('');
+}
+
+async function fetchStocks(query, offset = 0) {
+    currentQuery = query;
     try {
-        const response = await fetch(`/search?q=${encodeURIComponent(query)}`);
+        const response = await fetch(`/search?q=${encodeURIComponent(query)}&offset=${offset}${filterParams()}`);
         if (!response.ok) {
             throw new Error('Network response was not ok');
         }
-        const stocks = await response.json();
-        displayResults(stocks);
+        const data = await response.json();
+        if (offset === 0) {
+            displayFacets(data.facets || {});
+        }
+        displayResults(query, data, offset > 0);
     } catch (error) {
         console.error('Error fetching stocks:', error);
         resultsContainer.innerHTML = '<div class="empty-state"><p>Error fetching results. Please try again.</p></div>';
     }
 }
 
-function displayResults(stocks) {
-    resultsContainer.innerHTML = '';
+function displayFacets(facets) {
+    facetsContainer.innerHTML = '';
+
+    FACET_FIELDS.forEach(field => {
+        (facets[field] || []).forEach(facet => {
+            const active = (activeFilters[field] || []).includes(facet.value);
+            const chip = document.createElement('button');
+            chip.className = `facet-chip${active ? ' active' : ''}`;
+            chip.textContent = `${facet.value} (${facet.count})`;
+            chip.addEventListener('click', () => toggleFilter(field, facet.value));
+            facetsContainer.appendChild(chip);
+        });
+    });
+}
+
+function toggleFilter(field, value) {
+    const values = activeFilters[field] || [];
+    if (values.includes(value)) {
+        activeFilters[field] = values.filter(v => v !== value);
+    } else {
+        activeFilters[field] = [...values, value];
+    }
+    fetchStocks(currentQuery);
+}
+
+// displayDerivatives lists the contracts of a query such as "NIFTY 24500 CE"
+// under their underlying
+function displayDerivatives(groups) {
+    groups.forEach(group => {
+        const section = document.createElement('div');
+        section.className = 'derivative-group';
+        const rows = group.contracts
+            .map(contract => `
+                <li>
+                    <span class="symbol">${escapeHtml(contract.symbol)}</span>
+                    <span class="name">${escapeHtml(contract.expiry)} · lot ${contract.lot_size}</span>
+                </li>`)
+            .join('');
+        const title = group.listing ? `${escapeHtml(group.underlying)} · ${escapeHtml(group.listing.name)}` : escapeHtml(group.underlying);
+        section.innerHTML = `<div class="card-header"><span class="symbol">${title}</span></div><ul>${rows}</ul>`;
+        resultsContainer.appendChild(section);
+    });
+}
+
+function displayResults(query, data, append) {
+    const stocks = data.results;
+
+    // Drop the previous "load more" button; a new one is added if there is another page
+    const loadMore = resultsContainer.querySelector('.load-more');
+    if (loadMore) {
+        loadMore.remove();
+    }
+
+    if (!append) {
+        resultsContainer.innerHTML = '';
+        displayDerivatives(data.derivatives || []);
+    }
 
-    if (!stocks || stocks.length === 0) {
+    if (!append && (!stocks || stocks.length === 0) && !data.derivatives) {
         resultsContainer.innerHTML = '<div class="empty-state"><p>No stocks found.</p></div>';
         return;
     }
@@ -47,15 +201,45 @@ function displayResults(stocks) {
         const card = document.createElement('a');
         card.className = 'stock-card';
         card.href = `/stock.html?symbol=${encodeURIComponent(stock.symbol)}&exchange=${encodeURIComponent(stock.exchange)}`;
+        // Grouped results carry every exchange listing of the company
+        const listings = stock.listings || [{ exchange: stock.exchange, symbol: stock.symbol }];
+        const badges = listings
+            .map(listing => `<span class="exchange-badge" title="${escapeHtml(listing.symbol)}">${escapeHtml(listing.exchange)}</span>`)
+            .join('');
         card.innerHTML = `
             <div class="card-header">
-                <span class="symbol">${stock.symbol}</span>
-                <span class="exchange-badge">${stock.exchange}</span>
+                <span class="symbol">${stock.symbol}${typeBadge(stock.type)}${statusBadge(stock.status)}</span>
+                <span class="exchange-badges">${badges}</span>
             </div>
             <div class="name">${stock.name}</div>
         `;
         resultsContainer.appendChild(card);
     });
+
+    if (data.next_offset !== undefined) {
+        const button = document.createElement('button');
+        button.className = 'load-more';
+        button.textContent = `Show more (${data.total - data.next_offset} remaining)`;
+        button.addEventListener('click', () => fetchStocks(query, data.next_offset));
+        resultsContainer.appendChild(button);
+    }
+}
+
+// typeBadge marks ETFs, indices and mutual fund schemes
+function typeBadge(type) {
+    if (!type || type === 'Stock') {
+        return '';
+    }
+    return ` <span class="type-badge">${escapeHtml(type)}</span>`;
+}
+
+// statusBadge marks suspended, delisted and trade-to-trade listings
+function statusBadge(status, since, reason) {
+    if (!status || status === 'active') {
+        return '';
+    }
+    const title = [reason, since ? `since ${since}` : ''].filter(Boolean).join(', ');
+    return ` <span class="status-badge status-${escapeHtml(status)}" title="${escapeHtml(title)}">${escapeHtml(status.replace(/_/g, ' '))}</span>`;
 }
 
 async function fetchStockDetails(symbol, period = '1D', exchange = '') {
@@ -108,9 +292,15 @@ async function fetchStockDetails(symbol, period = '1D', exchange = '') {
         const sign = isUp ? '+' : '-';
         const colorClass = isUp ? 'positive' : 'negative';
 
+        // Looked up by a former symbol, e.g. TATAMOTORS for TMPV
+        const renamedNote = data.renamedFrom
+            ? `<div class="renamed-note">${escapeHtml(data.renamedFrom.alias)} now trades as ${escapeHtml(data.symbol)} (since ${escapeHtml(data.renamedFrom.effective)})</div>`
+            : '';
+
         container.innerHTML = `
             <div class="detail-header">
-                <div class="detail-symbol">${data.name}</div>
+                <div class="detail-symbol">${data.name}${typeBadge(data.type)}${statusBadge(data.status, data.status_since, data.status_reason)}</div>
+                ${renamedNote}
                 <div class="price-container">
                     <span class="current-price">${formattedPrice}</span>
                     <span class="price-change ${colorClass}">
@@ -128,6 +318,7 @@ async function fetchStockDetails(symbol, period = '1D', exchange = '') {
                 <div class="controls-container">
                     <div class="left-controls">
                          <button class="control-btn">${data.exchange}</button>
+                         <button class="control-btn chart-type-btn">${window.chartType === 'candle' ? 'Line' : 'Candles'}</button>
                     </div>
                     
                     <div class="time-period-filters">
@@ -167,6 +358,13 @@ async function fetchStockDetails(symbol, period = '1D', exchange = '') {
         }
         renderStockChart(data.history, period, data.previousDayClose, isUp);
 
+        // Switch between the line and candlestick charts without refetching
+        document.querySelector('.chart-type-btn').addEventListener('click', (e) => {
+            window.chartType = window.chartType === 'candle' ? 'line' : 'candle';
+            e.currentTarget.textContent = window.chartType === 'candle' ? 'Line' : 'Candles';
+            renderStockChart(data.history, period, data.previousDayClose, isUp);
+        });
+
         // Add event listeners to period buttons
         document.querySelectorAll('.period-btn').forEach(btn => {
             btn.addEventListener('click', (e) => {
@@ -208,6 +406,30 @@ function formatDateLabel(dateStr, period) {
     }
 }
 
+// formatTooltipDate shows the date of a point, with the time for intraday periods
+function formatTooltipDate(dateStr, period) {
+    const date = new Date(dateStr);
+
+    // For daily/weekly intervals (6M+), show only date
+    if (['6M', '1Y', '5Y', 'YTD'].includes(period)) {
+        return date.toLocaleDateString('en-IN', {
+            year: 'numeric',
+            month: 'short',
+            day: 'numeric'
+        });
+    }
+
+    // For intraday (1D, 1W, 1M), show date and time
+    return date.toLocaleString('en-IN', {
+        year: 'numeric',
+        month: 'short',
+        day: 'numeric',
+        hour: '2-digit',
+        minute: '2-digit',
+        hour12: true
+    });
+}
+
 function renderStockChart(historyData, period, previousClose, isUp) {
     const ctx = document.getElementById('stockChart').getContext('2d');
 
@@ -262,6 +484,12 @@ function renderStockChart(historyData, period, previousClose, isUp) {
 
     const baselineData = previousClose ? new Array(historyData.length).fill(previousClose) : [];
 
+    // Candles need open, high and low, which close-only histories lack
+    if (window.chartType === 'candle' && historyData.every(p => p.open !== undefined)) {
+        renderCandleChart(ctx, historyData, labels, period, maxTicksLimit);
+        return;
+    }
+
     window.myStockChart = new Chart(ctx, {
         type: 'line',
         data: {
@@ -316,28 +544,7 @@ function renderStockChart(historyData, period, previousClose, isUp) {
                     callbacks: {
                         title: function (context) {
                             // Show full date and time in tooltip
-                            const index = context[0].dataIndex;
-                            const date = new Date(historyData[index].date);
-                            // console.log('Tooltip:', index, historyData[index].date, date);
-
-                            // For daily/weekly intervals (6M+), show only date
-                            if (['6M', '1Y', '5Y', 'YTD'].includes(period)) {
-                                return date.toLocaleDateString('en-IN', {
-                                    year: 'numeric',
-                                    month: 'short',
-                                    day: 'numeric'
-                                });
-                            }
-
-                            // For intraday (1D, 1W, 1M), show date and time
-                            return date.toLocaleString('en-IN', {
-                                year: 'numeric',
-                                month: 'short',
-                                day: 'numeric',
-                                hour: '2-digit',
-                                minute: '2-digit',
-                                hour12: true
-                            });
+                            return formatTooltipDate(historyData[context[0].dataIndex].date, period);
                         },
                         label: function (context) {
                             if (context.dataset.label === 'Previous Close') return 'Prev Close: ₹' + context.parsed.y.toFixed(2);
@@ -380,3 +587,128 @@ function renderStockChart(historyData, period, previousClose, isUp) {
     });
 }
 
+// renderCandleChart draws candlesticks over volume bars. Chart.js has no
+// candlestick type without the financial plugin, so each candle is two floating
+// bars: a thin wick from low to high behind a body from open to close
+function renderCandleChart(ctx, historyData, labels, period, maxTicksLimit) {
+    const colors = historyData.map(p => p.close >= p.open ? '#00d09c' : '#eb5b3c');
+    const hasVolume = historyData.some(p => p.volume);
+    const priceFormatter = new Intl.NumberFormat('en-IN', {
+        minimumFractionDigits: 2,
+        maximumFractionDigits: 2
+    });
+
+    window.myStockChart = new Chart(ctx, {
+        type: 'bar',
+        data: {
+            labels: labels,
+            datasets: [
+                {
+                    label: 'Wick',
+                    data: historyData.map(p => [p.low, p.high]),
+                    backgroundColor: colors,
+                    barPercentage: 0.15,
+                    grouped: false,
+                    yAxisID: 'y'
+                },
+                {
+                    label: 'Candle',
+                    data: historyData.map(p => [p.open, p.close]),
+                    backgroundColor: colors,
+                    barPercentage: 0.8,
+                    minBarLength: 1, // a candle that closes at its open is still visible
+                    grouped: false,
+                    yAxisID: 'y'
+                },
+                ...(hasVolume ? [{
+                    label: 'Volume',
+                    data: historyData.map(p => p.volume || 0),
+                    backgroundColor: 'rgba(124, 126, 140, 0.3)',
+                    grouped: false,
+                    yAxisID: 'volume'
+                }] : [])
+            ]
+        },
+        options: {
+            responsive: true,
+            maintainAspectRatio: false,
+            interaction: {
+                intersect: false,
+                mode: 'index',
+            },
+            plugins: {
+                legend: {
+                    display: false
+                },
+                tooltip: {
+                    backgroundColor: '#fff',
+                    titleColor: '#444',
+                    bodyColor: '#444',
+                    borderColor: '#e5e7eb',
+                    borderWidth: 1,
+                    displayColors: false,
+                    padding: 10,
+                    filter: item => item.dataset.label !== 'Wick',
+                    callbacks: {
+                        title: function (context) {
+                            return formatTooltipDate(historyData[context[0].dataIndex].date, period);
+                        },
+                        label: function (context) {
+                            const p = historyData[context.dataIndex];
+                            if (context.dataset.label === 'Volume') {
+                                return 'Volume: ' + p.volume.toLocaleString('en-IN');
+                            }
+                            return [
+                                'Open: ₹' + priceFormatter.format(p.open),
+                                'High: ₹' + priceFormatter.format(p.high),
+                                'Low: ₹' + priceFormatter.format(p.low),
+                                'Close: ₹' + priceFormatter.format(p.close)
+                            ];
+                        }
+                    }
+                }
+            },
+            scales: {
+                // Prices take the top three quarters of the chart, volume the rest
+                y: {
+                    position: 'right',
+                    stack: 'candles',
+                    stackWeight: 3,
+                    grid: {
+                        display: false,
+                        drawBorder: false
+                    },
+                    ticks: {
+                        display: false
+                    }
+                },
+                ...(hasVolume ? {
+                    volume: {
+                        position: 'right',
+                        stack: 'candles',
+                        stackWeight: 1,
+                        beginAtZero: true,
+                        grid: {
+                            display: false,
+                            drawBorder: false
+                        },
+                        ticks: {
+                            display: false
+                        }
+                    }
+                } : {}),
+                x: {
+                    display: true,
+                    grid: {
+                        display: false,
+                        drawBorder: false
+                    },
+                    ticks: {
+                        display: false,
+                        maxTicksLimit: maxTicksLimit
+                    }
+                }
+            }
+        }
+    });
+}
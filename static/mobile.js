@@ -39,8 +39,8 @@ async function fetchStocks(query) {
         if (!response.ok) {
             throw new Error('Network response was not ok');
         }
-        const stocks = await response.json();
-        displayResults(stocks);
+        const data = await response.json();
+        displayResults(data.results);
     } catch (error) {
         console.error('Error fetching stocks:', error);
         resultsContainer.innerHTML = '<div class="error">Error fetching results. Please try again.</div>';